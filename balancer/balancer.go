@@ -0,0 +1,137 @@
+package balancer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+	"github.com/pkg/errors"
+)
+
+// Built-in balancer names
+const (
+	RoundRobin         = "round_robin"
+	WeightedRoundRobin = "weighted_round_robin"
+	Random             = "random"
+	P2C                = "p2c"
+	ConsistentHash     = "consistent_hash"
+)
+
+// ErrNoInstance is returned when there is no enabled and healthy instance to pick
+var ErrNoInstance = errors.New("no available instance")
+
+// DoneFunc is called when the request to the picked instance is finished
+type DoneFunc func(err error)
+
+// Balancer picks one instance from the instances of a service
+type Balancer interface {
+	// Pick selects an enabled and healthy instance, the returned DoneFunc must be called
+	// once the request is finished
+	Pick(instances []discovery.ServiceInstance, opts ...PickOption) (discovery.ServiceInstance, DoneFunc, error)
+}
+
+// Builder creates a new Balancer
+type Builder func() Balancer
+
+// PickOptions for picking an instance
+type PickOptions struct {
+	// Key is used by the consistent hash balancer
+	Key string
+}
+
+// PickOption for pick options
+type PickOption func(*PickOptions)
+
+// WithKey set key function
+func WithKey(key string) PickOption {
+	return func(o *PickOptions) {
+		o.Key = key
+	}
+}
+
+type keyCtx struct{}
+
+// WithContextKey returns a context carrying the consistent hash key, used by the gRPC and HTTP integrations
+func WithContextKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, keyCtx{}, key)
+}
+
+// KeyFromContext returns the consistent hash key stored by WithContextKey
+func KeyFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	key, _ := ctx.Value(keyCtx{}).(string)
+	return key
+}
+
+var (
+	buildersLock sync.RWMutex
+	builders     = map[string]Builder{
+		RoundRobin:         newRoundRobin,
+		WeightedRoundRobin: newWeightedRoundRobin,
+		Random:             newRandom,
+		P2C:                newP2C,
+		ConsistentHash:     newConsistentHash,
+	}
+)
+
+// Register registers a balancer builder by name, it replaces the builder with the same name
+func Register(name string, builder Builder) {
+	buildersLock.Lock()
+	defer buildersLock.Unlock()
+	builders[name] = builder
+}
+
+// New returns a new Balancer registered by name
+func New(name string) (Balancer, error) {
+	buildersLock.RLock()
+	builder, ok := builders[name]
+	buildersLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown balancer[name=%s]", name)
+	}
+	return builder(), nil
+}
+
+// Names returns the registered balancer names
+func Names() []string {
+	buildersLock.RLock()
+	defer buildersLock.RUnlock()
+	names := make([]string, 0, len(builders))
+	for name := range builders {
+		names = append(names, name)
+	}
+	return names
+}
+
+func newPickOptions(opts []PickOption) PickOptions {
+	var o PickOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// available returns the enabled and healthy instances
+func available(instances []discovery.ServiceInstance) []discovery.ServiceInstance {
+	nodes := make([]discovery.ServiceInstance, 0, len(instances))
+	for _, ins := range instances {
+		if ins == nil || !ins.IsEnable() || !ins.IsHealthy() {
+			continue
+		}
+		nodes = append(nodes, ins)
+	}
+	return nodes
+}
+
+// weight returns the instance weight, instances without weight count as 1
+func weight(ins discovery.ServiceInstance) float64 {
+	if w := ins.GetWeight(); w > 0 {
+		return w
+	}
+	return 1
+}
+
+func noopDone(error) {}
@@ -0,0 +1,30 @@
+package balancer
+
+import (
+	"testing"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+)
+
+// newInstances returns enabled and healthy instances with weight 1
+func newInstances(ids ...string) []discovery.ServiceInstance {
+	var list []discovery.ServiceInstance
+	for _, id := range ids {
+		list = append(list, &discovery.DefaultServiceInstance{Id: id, Enable: true, Healthy: true, Weight: 1})
+	}
+	return list
+}
+
+// pickIds picks and finishes n times and returns the picked ids
+func pickIds(t testing.TB, b Balancer, instances []discovery.ServiceInstance, n int, opts ...PickOption) []string {
+	ids := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		ins, done, err := b.Pick(instances, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		done(nil)
+		ids = append(ids, ins.GetId())
+	}
+	return ids
+}
@@ -0,0 +1,74 @@
+package balancer
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+)
+
+// replicas is the number of virtual nodes per instance
+const replicas = 160
+
+// consistentHash picks the instance owning the key on a hash ring, instances without key are picked randomly
+type consistentHash struct {
+	mu        sync.Mutex
+	signature string
+	hashes    []uint32
+	ring      map[uint32]discovery.ServiceInstance
+	fallback  Balancer
+}
+
+func newConsistentHash() Balancer {
+	return &consistentHash{fallback: newRandom()}
+}
+
+func (b *consistentHash) Pick(instances []discovery.ServiceInstance, opts ...PickOption) (discovery.ServiceInstance, DoneFunc, error) {
+	o := newPickOptions(opts)
+	if o.Key == "" {
+		return b.fallback.Pick(instances, opts...)
+	}
+	nodes := available(instances)
+	if len(nodes) == 0 {
+		return nil, nil, ErrNoInstance
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.build(nodes)
+
+	h := crc32.ChecksumIEEE([]byte(o.Key))
+	idx := sort.Search(len(b.hashes), func(i int) bool { return b.hashes[i] >= h })
+	if idx == len(b.hashes) {
+		idx = 0
+	}
+	return b.ring[b.hashes[idx]], noopDone, nil
+}
+
+// build rebuilds the ring when the instances changed
+func (b *consistentHash) build(nodes []discovery.ServiceInstance) {
+	ids := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		ids = append(ids, node.GetId())
+	}
+	sort.Strings(ids)
+	signature := strings.Join(ids, ",")
+	if signature == b.signature {
+		return
+	}
+
+	b.signature = signature
+	b.hashes = b.hashes[:0]
+	b.ring = make(map[uint32]discovery.ServiceInstance, len(nodes)*replicas)
+	for _, node := range nodes {
+		for i := 0; i < replicas; i++ {
+			h := crc32.ChecksumIEEE([]byte(strconv.Itoa(i) + node.GetId()))
+			b.ring[h] = node
+			b.hashes = append(b.hashes, h)
+		}
+	}
+	sort.Slice(b.hashes, func(i, j int) bool { return b.hashes[i] < b.hashes[j] })
+}
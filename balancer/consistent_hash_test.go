@@ -0,0 +1,52 @@
+package balancer
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestConsistentHashAffinity(t *testing.T) {
+	instances := newInstances("a", "b", "c", "d")
+	b := newConsistentHash()
+	other := newConsistentHash()
+	for i := 0; i < 100; i++ {
+		key := "user-" + strconv.Itoa(i)
+		ids := pickIds(t, b, instances, 5, WithKey(key))
+		for _, id := range ids[1:] {
+			if id != ids[0] {
+				t.Fatalf("key %s picked %v", key, ids)
+			}
+		}
+		// the ring does not depend on the balancer nor on the instance order
+		reversed := newInstances("d", "c", "b", "a")
+		if id := pickIds(t, other, reversed, 1, WithKey(key))[0]; id != ids[0] {
+			t.Fatalf("key %s picked %s and %s", key, ids[0], id)
+		}
+	}
+}
+
+func TestConsistentHashRemove(t *testing.T) {
+	b := newConsistentHash()
+	before := make(map[string]string)
+	for i := 0; i < 1000; i++ {
+		key := "user-" + strconv.Itoa(i)
+		before[key] = pickIds(t, b, newInstances("a", "b", "c", "d"), 1, WithKey(key))[0]
+	}
+
+	var moved int
+	for key, id := range before {
+		got := pickIds(t, b, newInstances("a", "b", "d"), 1, WithKey(key))[0]
+		switch {
+		case id == "c":
+			moved++
+			if got == "c" {
+				t.Fatalf("key %s picked the removed instance", key)
+			}
+		case got != id:
+			t.Fatalf("key %s moved from %s to %s", key, id, got)
+		}
+	}
+	if moved == 0 {
+		t.Fatal("no key was on the removed instance")
+	}
+}
@@ -0,0 +1,101 @@
+package balancer
+
+import (
+	"github.com/donetkit/contrib_discovery/discovery"
+	grpcBalancer "google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/resolver"
+)
+
+// GRPCPrefix prefixes the balancer names registered to gRPC,
+// e.g. grpc.WithDefaultServiceConfig(`{"loadBalancingConfig": [{"discovery_p2c":{}}]}`)
+const GRPCPrefix = "discovery_"
+
+func init() {
+	for _, name := range Names() {
+		RegisterGRPC(name)
+	}
+}
+
+// RegisterGRPC registers the balancer named name to gRPC as GRPCPrefix+name
+func RegisterGRPC(name string) {
+	grpcBalancer.Register(&grpcBuilder{name: name})
+}
+
+// grpcBuilder builds a base balancer per ClientConn, each with its own Balancer
+// so the balancer state (counters, weights) outlives the picker updates
+type grpcBuilder struct {
+	name string
+}
+
+func (b *grpcBuilder) Name() string {
+	return GRPCPrefix + b.name
+}
+
+func (b *grpcBuilder) Build(cc grpcBalancer.ClientConn, opts grpcBalancer.BuildOptions) grpcBalancer.Balancer {
+	pb := &pickerBuilder{}
+	pb.balancer, pb.err = New(b.name)
+	return base.NewBalancerBuilder(b.Name(), pb, base.Config{HealthCheck: true}).Build(cc, opts)
+}
+
+type instanceKey struct{}
+
+// SetInstance stores the service instance in the address, used by the gRPC resolver
+func SetInstance(addr resolver.Address, ins discovery.ServiceInstance) resolver.Address {
+	addr.BalancerAttributes = addr.BalancerAttributes.WithValue(instanceKey{}, ins)
+	return addr
+}
+
+// GetInstance returns the service instance stored in the address by SetInstance
+func GetInstance(addr resolver.Address) discovery.ServiceInstance {
+	ins, _ := addr.BalancerAttributes.Value(instanceKey{}).(discovery.ServiceInstance)
+	return ins
+}
+
+type pickerBuilder struct {
+	balancer Balancer
+	err      error
+}
+
+func (pb *pickerBuilder) Build(info base.PickerBuildInfo) grpcBalancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(grpcBalancer.ErrNoSubConnAvailable)
+	}
+	if pb.err != nil {
+		return base.NewErrPicker(pb.err)
+	}
+
+	p := &picker{
+		balancer: pb.balancer,
+		subConns: make(map[string]grpcBalancer.SubConn, len(info.ReadySCs)),
+	}
+	for sc, scInfo := range info.ReadySCs {
+		ins := GetInstance(scInfo.Address)
+		if ins == nil {
+			// address not from the discovery resolver
+			ins = &discovery.DefaultServiceInstance{Id: scInfo.Address.Addr, Host: scInfo.Address.Addr, Enable: true, Healthy: true}
+		}
+		p.instances = append(p.instances, ins)
+		p.subConns[ins.GetId()] = sc
+	}
+	return p
+}
+
+type picker struct {
+	balancer  Balancer
+	instances []discovery.ServiceInstance
+	subConns  map[string]grpcBalancer.SubConn
+}
+
+func (p *picker) Pick(info grpcBalancer.PickInfo) (grpcBalancer.PickResult, error) {
+	ins, done, err := p.balancer.Pick(p.instances, WithKey(KeyFromContext(info.Ctx)))
+	if err != nil {
+		return grpcBalancer.PickResult{}, grpcBalancer.ErrNoSubConnAvailable
+	}
+	return grpcBalancer.PickResult{
+		SubConn: p.subConns[ins.GetId()],
+		Done: func(di grpcBalancer.DoneInfo) {
+			done(di.Err)
+		},
+	}, nil
+}
@@ -0,0 +1,81 @@
+package balancer
+
+import (
+	"context"
+	"testing"
+
+	grpcBalancer "google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/resolver"
+)
+
+// subConn is a fake SubConn, the picker only hands it back
+type subConn struct {
+	grpcBalancer.SubConn
+	id string
+}
+
+func buildPicker(t *testing.T, name string, ids ...string) grpcBalancer.Picker {
+	t.Helper()
+	pb := &pickerBuilder{}
+	pb.balancer, pb.err = New(name)
+	info := base.PickerBuildInfo{ReadySCs: make(map[grpcBalancer.SubConn]base.SubConnInfo)}
+	for _, ins := range newInstances(ids...) {
+		addr := SetInstance(resolver.Address{Addr: ins.GetId() + ":8080"}, ins)
+		info.ReadySCs[&subConn{id: ins.GetId()}] = base.SubConnInfo{Address: addr}
+	}
+	return pb.Build(info)
+}
+
+func TestPickerSubConn(t *testing.T) {
+	p := buildPicker(t, ConsistentHash, "a", "b", "c")
+	b := newConsistentHash()
+	instances := newInstances("a", "b", "c")
+	for _, key := range []string{"x", "y", "z"} {
+		res, err := p.Pick(grpcBalancer.PickInfo{Ctx: WithContextKey(context.Background(), key)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := pickIds(t, b, instances, 1, WithKey(key))[0]
+		if got := res.SubConn.(*subConn).id; got != want {
+			t.Fatalf("key %s: picked %s, want %s", key, got, want)
+		}
+	}
+}
+
+func TestPickerDone(t *testing.T) {
+	p := buildPicker(t, P2C, "a")
+	res, err := p.Pick(grpcBalancer.PickInfo{Ctx: context.Background()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	counter := p.(*picker).balancer.(*p2c).inflight["a"]
+	if *counter != 1 {
+		t.Fatalf("in flight = %d before Done, want 1", *counter)
+	}
+	res.Done(grpcBalancer.DoneInfo{})
+	if *counter != 0 {
+		t.Fatalf("in flight = %d after Done, want 0", *counter)
+	}
+}
+
+func TestPickerNoSubConn(t *testing.T) {
+	p := buildPicker(t, RoundRobin)
+	if _, err := p.Pick(grpcBalancer.PickInfo{Ctx: context.Background()}); err != grpcBalancer.ErrNoSubConnAvailable {
+		t.Fatalf("Pick() error = %v, want ErrNoSubConnAvailable", err)
+	}
+
+	// the addresses not from the discovery resolver are picked by address
+	pb := &pickerBuilder{balancer: newRoundRobin()}
+	sc := &subConn{id: "static"}
+	p = pb.Build(base.PickerBuildInfo{ReadySCs: map[grpcBalancer.SubConn]base.SubConnInfo{
+		sc: {Address: resolver.Address{Addr: "10.0.0.1:8080"}},
+	}})
+	res, err := p.Pick(grpcBalancer.PickInfo{Ctx: context.Background()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.SubConn != sc {
+		t.Fatalf("picked %v, want %v", res.SubConn, sc)
+	}
+}
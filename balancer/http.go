@@ -0,0 +1,89 @@
+package balancer
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+)
+
+// Instances returns the current instances of a service, e.g. from a watcher
+type Instances func() []discovery.ServiceInstance
+
+// RoundTripper is a http.RoundTripper sending each request to an instance picked by the balancer.
+// The consistent hash key is read from the request context, see WithContextKey.
+type RoundTripper struct {
+	balancer  Balancer
+	instances Instances
+	next      http.RoundTripper
+}
+
+// NewRoundTripper returns a RoundTripper using the balancer registered by name,
+// next defaults to http.DefaultTransport
+func NewRoundTripper(name string, instances Instances, next http.RoundTripper) (*RoundTripper, error) {
+	b, err := New(name)
+	if err != nil {
+		return nil, err
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &RoundTripper{balancer: b, instances: instances, next: next}, nil
+}
+
+// RoundTrip implements http.RoundTripper
+func (rt *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	ins, done, err := rt.balancer.Pick(rt.instances(), WithKey(KeyFromContext(req.Context())))
+	if err != nil {
+		return nil, err
+	}
+
+	r := req.Clone(req.Context())
+	r.URL.Host = net.JoinHostPort(ins.GetHost(), strconv.FormatUint(ins.GetPort(), 10))
+	if r.Host == req.URL.Host {
+		// the Host header follows the picked instance unless it was set explicitly
+		r.Host = ""
+	}
+	resp, err := rt.next.RoundTrip(r)
+	if err != nil || resp == nil || resp.Body == nil {
+		done(err)
+		return resp, err
+	}
+	// the request is in flight until the body is closed
+	if rwc, ok := resp.Body.(io.ReadWriteCloser); ok {
+		// keep the body writable for the switching protocols responses
+		resp.Body = &doneReadWriteCloser{ReadWriteCloser: rwc, done: done}
+	} else {
+		resp.Body = &doneReadCloser{ReadCloser: resp.Body, done: done}
+	}
+	return resp, nil
+}
+
+// doneReadCloser calls done once when the body is closed
+type doneReadCloser struct {
+	io.ReadCloser
+	once sync.Once
+	done DoneFunc
+}
+
+func (b *doneReadCloser) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() { b.done(nil) })
+	return err
+}
+
+// doneReadWriteCloser calls done once when the body is closed
+type doneReadWriteCloser struct {
+	io.ReadWriteCloser
+	once sync.Once
+	done DoneFunc
+}
+
+func (b *doneReadWriteCloser) Close() error {
+	err := b.ReadWriteCloser.Close()
+	b.once.Do(func() { b.done(nil) })
+	return err
+}
@@ -0,0 +1,123 @@
+package balancer
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+	"github.com/pkg/errors"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestRoundTripperHost(t *testing.T) {
+	instances := func() []discovery.ServiceInstance {
+		return []discovery.ServiceInstance{&discovery.DefaultServiceInstance{Id: "a", Host: "10.0.0.1", Port: 8080, Enable: true, Healthy: true}}
+	}
+	var sent *http.Request
+	rt, err := NewRoundTripper(RoundRobin, instances, roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		sent = r
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		host string
+		want string
+	}{
+		// the Host of http.NewRequest follows the URL
+		{host: "", want: ""},
+		{host: "api", want: ""},
+		{host: "api.example.com", want: "api.example.com"},
+	} {
+		req, err := http.NewRequest(http.MethodGet, "http://api/users", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.host != "" {
+			req.Host = c.host
+		}
+		if _, err := rt.RoundTrip(req); err != nil {
+			t.Fatal(err)
+		}
+		if sent.URL.Host != "10.0.0.1:8080" || sent.Host != c.want {
+			t.Fatalf("Host %q: sent to %s with Host %q, want %q", c.host, sent.URL.Host, sent.Host, c.want)
+		}
+	}
+}
+
+// body records its Close
+type body struct {
+	io.Reader
+	closed bool
+}
+
+func (b *body) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestRoundTripperDoneOnClose(t *testing.T) {
+	var inflight int
+	b := balancerFunc(func(instances []discovery.ServiceInstance, _ ...PickOption) (discovery.ServiceInstance, DoneFunc, error) {
+		inflight++
+		return instances[0], func(error) { inflight-- }, nil
+	})
+	instances := func() []discovery.ServiceInstance {
+		return []discovery.ServiceInstance{&discovery.DefaultServiceInstance{Id: "a", Host: "10.0.0.1", Port: 8080, Enable: true, Healthy: true}}
+	}
+	fail := errors.New("connection refused")
+	var respBody *body
+	rt := &RoundTripper{balancer: b, instances: instances, next: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		if r.Header.Get("fail") != "" {
+			return nil, fail
+		}
+		respBody = &body{Reader: strings.NewReader("streamed")}
+		return &http.Response{StatusCode: http.StatusOK, Body: respBody}, nil
+	})}
+
+	req, err := http.NewRequest(http.MethodGet, "http://api/stream", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = io.ReadAll(resp.Body); err != nil {
+		t.Fatal(err)
+	}
+	if inflight != 1 {
+		t.Fatalf("in flight = %d before Close, want 1", inflight)
+	}
+	for i := 0; i < 2; i++ {
+		if err = resp.Body.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if inflight != 0 || !respBody.closed {
+		t.Fatalf("in flight = %d and closed = %v after Close, want 0 and true", inflight, respBody.closed)
+	}
+
+	req.Header.Set("fail", "1")
+	if _, err = rt.RoundTrip(req); err != fail {
+		t.Fatalf("RoundTrip() error = %v, want %v", err, fail)
+	}
+	if inflight != 0 {
+		t.Fatalf("in flight = %d after an error, want 0", inflight)
+	}
+}
+
+type balancerFunc func(instances []discovery.ServiceInstance, opts ...PickOption) (discovery.ServiceInstance, DoneFunc, error)
+
+func (f balancerFunc) Pick(instances []discovery.ServiceInstance, opts ...PickOption) (discovery.ServiceInstance, DoneFunc, error) {
+	return f(instances, opts...)
+}
@@ -0,0 +1,76 @@
+package balancer
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+)
+
+// p2c picks two random instances and selects the one with less in-flight requests per weight
+type p2c struct {
+	mu       sync.Mutex
+	inflight map[string]*int64
+}
+
+func newP2C() Balancer {
+	return &p2c{inflight: make(map[string]*int64)}
+}
+
+func (b *p2c) Pick(instances []discovery.ServiceInstance, _ ...PickOption) (discovery.ServiceInstance, DoneFunc, error) {
+	b.prune(instances)
+	nodes := available(instances)
+	if len(nodes) == 0 {
+		return nil, nil, ErrNoInstance
+	}
+
+	selected := nodes[0]
+	if len(nodes) > 1 {
+		a := rand.Intn(len(nodes))
+		c := rand.Intn(len(nodes) - 1)
+		if c >= a {
+			c++
+		}
+		selected = nodes[a]
+		if b.load(nodes[c]) < b.load(selected) {
+			selected = nodes[c]
+		}
+	}
+
+	counter := b.counter(selected.GetId())
+	atomic.AddInt64(counter, 1)
+	return selected, func(error) {
+		atomic.AddInt64(counter, -1)
+	}, nil
+}
+
+func (b *p2c) load(ins discovery.ServiceInstance) float64 {
+	return float64(atomic.LoadInt64(b.counter(ins.GetId()))) / weight(ins)
+}
+
+func (b *p2c) counter(id string) *int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c, ok := b.inflight[id]
+	if !ok {
+		c = new(int64)
+		b.inflight[id] = c
+	}
+	return c
+}
+
+// prune drops the counters of the instances that are not in the list
+func (b *p2c) prune(instances []discovery.ServiceInstance) {
+	ids := make(map[string]struct{}, len(instances))
+	for _, ins := range instances {
+		ids[ins.GetId()] = struct{}{}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for id := range b.inflight {
+		if _, ok := ids[id]; !ok {
+			delete(b.inflight, id)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package balancer
+
+import "testing"
+
+func TestP2CPrune(t *testing.T) {
+	b := newP2C().(*p2c)
+	for _, ids := range [][]string{{"a", "b"}, {"c", "d"}, {"e"}} {
+		for i := 0; i < 20; i++ {
+			_, done, err := b.Pick(newInstances(ids...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			done(nil)
+		}
+		if len(b.inflight) > len(ids) {
+			t.Fatalf("%d counters for %d instances", len(b.inflight), len(ids))
+		}
+	}
+	if _, ok := b.inflight["e"]; !ok || len(b.inflight) != 1 {
+		t.Fatalf("counters = %v, want e only", b.inflight)
+	}
+}
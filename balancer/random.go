@@ -0,0 +1,21 @@
+package balancer
+
+import (
+	"math/rand"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+)
+
+type random struct{}
+
+func newRandom() Balancer {
+	return &random{}
+}
+
+func (b *random) Pick(instances []discovery.ServiceInstance, _ ...PickOption) (discovery.ServiceInstance, DoneFunc, error) {
+	nodes := available(instances)
+	if len(nodes) == 0 {
+		return nil, nil, ErrNoInstance
+	}
+	return nodes[rand.Intn(len(nodes))], noopDone, nil
+}
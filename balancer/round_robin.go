@@ -0,0 +1,24 @@
+package balancer
+
+import (
+	"sync/atomic"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+)
+
+type roundRobin struct {
+	next uint64
+}
+
+func newRoundRobin() Balancer {
+	return &roundRobin{}
+}
+
+func (b *roundRobin) Pick(instances []discovery.ServiceInstance, _ ...PickOption) (discovery.ServiceInstance, DoneFunc, error) {
+	nodes := available(instances)
+	if len(nodes) == 0 {
+		return nil, nil, ErrNoInstance
+	}
+	idx := atomic.AddUint64(&b.next, 1) - 1
+	return nodes[idx%uint64(len(nodes))], noopDone, nil
+}
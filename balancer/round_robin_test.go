@@ -0,0 +1,29 @@
+package balancer
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+)
+
+func TestRoundRobinOrder(t *testing.T) {
+	b := newRoundRobin()
+	got := pickIds(t, b, newInstances("a", "b", "c"), 7)
+	if want := []string{"a", "b", "c", "a", "b", "c", "a"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("picked %v, want %v", got, want)
+	}
+}
+
+func TestRoundRobinSkipsUnavailable(t *testing.T) {
+	instances := newInstances("a", "b", "c")
+	instances[1].(*discovery.DefaultServiceInstance).Healthy = false
+	got := pickIds(t, newRoundRobin(), instances, 4)
+	if want := []string{"a", "c", "a", "c"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("picked %v, want %v", got, want)
+	}
+
+	if _, _, err := newRoundRobin().Pick(nil); err != ErrNoInstance {
+		t.Fatalf("Pick() error = %v, want ErrNoInstance", err)
+	}
+}
@@ -0,0 +1,51 @@
+package balancer
+
+import (
+	"sync"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+)
+
+// weightedRoundRobin is the smooth weighted round-robin used by nginx
+type weightedRoundRobin struct {
+	mu      sync.Mutex
+	current map[string]float64
+}
+
+func newWeightedRoundRobin() Balancer {
+	return &weightedRoundRobin{current: make(map[string]float64)}
+}
+
+func (b *weightedRoundRobin) Pick(instances []discovery.ServiceInstance, _ ...PickOption) (discovery.ServiceInstance, DoneFunc, error) {
+	nodes := available(instances)
+	if len(nodes) == 0 {
+		return nil, nil, ErrNoInstance
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var (
+		total    float64
+		selected discovery.ServiceInstance
+		seen     = make(map[string]struct{}, len(nodes))
+	)
+	for _, node := range nodes {
+		w := weight(node)
+		total += w
+		b.current[node.GetId()] += w
+		seen[node.GetId()] = struct{}{}
+		if selected == nil || b.current[node.GetId()] > b.current[selected.GetId()] {
+			selected = node
+		}
+	}
+	b.current[selected.GetId()] -= total
+
+	// forget instances that are gone
+	for id := range b.current {
+		if _, ok := seen[id]; !ok {
+			delete(b.current, id)
+		}
+	}
+	return selected, noopDone, nil
+}
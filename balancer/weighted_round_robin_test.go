@@ -0,0 +1,52 @@
+package balancer
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+)
+
+func weighted(weights map[string]float64, ids ...string) []discovery.ServiceInstance {
+	instances := newInstances(ids...)
+	for _, ins := range instances {
+		ins.(*discovery.DefaultServiceInstance).Weight = weights[ins.GetId()]
+	}
+	return instances
+}
+
+func TestWeightedRoundRobinSmooth(t *testing.T) {
+	// the sequence of nginx for the weights 5, 1, 1, the light instances are not picked in a row
+	instances := weighted(map[string]float64{"a": 5, "b": 1, "c": 1}, "a", "b", "c")
+	b := newWeightedRoundRobin()
+	want := []string{"a", "a", "b", "a", "c", "a", "a"}
+	for round := 0; round < 3; round++ {
+		if got := pickIds(t, b, instances, len(want)); !reflect.DeepEqual(got, want) {
+			t.Fatalf("round %d: picked %v, want %v", round, got, want)
+		}
+	}
+}
+
+func TestWeightedRoundRobinDistribution(t *testing.T) {
+	instances := weighted(map[string]float64{"a": 4, "b": 2, "c": 1}, "a", "b", "c")
+	b := newWeightedRoundRobin()
+	counts := make(map[string]int)
+	for _, id := range pickIds(t, b, instances, 700) {
+		counts[id]++
+	}
+	if want := map[string]int{"a": 400, "b": 200, "c": 100}; !reflect.DeepEqual(counts, want) {
+		t.Fatalf("counts = %v, want %v", counts, want)
+	}
+
+	// a removed instance is forgotten and the others keep their share
+	counts = make(map[string]int)
+	for _, id := range pickIds(t, b, instances[:2], 60) {
+		counts[id]++
+	}
+	if want := map[string]int{"a": 40, "b": 20}; !reflect.DeepEqual(counts, want) {
+		t.Fatalf("counts = %v, want %v", counts, want)
+	}
+	if _, ok := b.(*weightedRoundRobin).current["c"]; ok {
+		t.Fatal("the weight of the removed instance is kept")
+	}
+}
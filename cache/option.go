@@ -0,0 +1,38 @@
+package cache
+
+import "time"
+
+// Options for the cache registry
+type Options struct {
+	// Dir is the snapshot directory, snapshots are disabled when blank
+	Dir string
+	// OnError is called with the errors of the snapshot writes
+	OnError func(err error)
+	// SnapshotExpiry is how long the snapshot versions the watcher does not report are served
+	// after its first result, 30 seconds by default
+	SnapshotExpiry time.Duration
+}
+
+// Option for cache registry
+type Option func(*Options)
+
+// WithDir set snapshot dir function
+func WithDir(dir string) Option {
+	return func(o *Options) {
+		o.Dir = dir
+	}
+}
+
+// WithOnError set snapshot error callback function
+func WithOnError(callback func(err error)) Option {
+	return func(o *Options) {
+		o.OnError = callback
+	}
+}
+
+// WithSnapshotExpiry set snapshot expiry function
+func WithSnapshotExpiry(expiry time.Duration) Option {
+	return func(o *Options) {
+		o.SnapshotExpiry = expiry
+	}
+}
@@ -0,0 +1,357 @@
+package cache
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+	"github.com/donetkit/contrib_discovery/watcher"
+	"github.com/pkg/errors"
+)
+
+// snapshotExt is the extension of the snapshot files, one per service
+const snapshotExt = ".json"
+
+// defaultSnapshotExpiry is the default of Options.SnapshotExpiry
+const defaultSnapshotExpiry = 30 * time.Second
+
+// Registry answers service lookups from memory, it is fed by a watcher and
+// persists a snapshot of every changed service so lookups survive agent outages and cold starts
+type Registry struct {
+	options Options
+	watcher watcher.Watcher
+	exit    chan struct{}
+	done    chan struct{}
+
+	mu       sync.RWMutex
+	services map[string]*entry
+	// expiry drops the snapshot versions the watcher has not confirmed, it starts on the first result
+	expiry *time.Timer
+	// persistMu serializes the snapshot writes of the watcher and of the expiry
+	persistMu sync.Mutex
+}
+
+type entry struct {
+	// versions are the instances keyed by version
+	versions map[string][]*discovery.DefaultServiceInstance
+	// snapshot are the versions loaded from the snapshot and not confirmed by the watcher yet
+	snapshot map[string]bool
+}
+
+// snapshot is the persisted form of a service
+type snapshot struct {
+	Name     string                                         `json:"name"`
+	Versions map[string][]*discovery.DefaultServiceInstance `json:"versions"`
+}
+
+// New loads the snapshot from Options.Dir and starts consuming the watcher
+func New(w watcher.Watcher, opts ...Option) (*Registry, error) {
+	o := Options{SnapshotExpiry: defaultSnapshotExpiry}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	r := &Registry{
+		options:  o,
+		watcher:  w,
+		exit:     make(chan struct{}),
+		done:     make(chan struct{}),
+		services: make(map[string]*entry),
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	go r.run()
+	return r, nil
+}
+
+// GetService returns the service grouped by version
+func (r *Registry) GetService(name string) ([]*discovery.Service, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	e, ok := r.services[name]
+	if !ok || len(e.versions) == 0 {
+		return nil, errors.Wrapf(discovery.ErrServiceNotFound, "get service error[name=%s]", name)
+	}
+
+	versions := make([]string, 0, len(e.versions))
+	for version := range e.versions {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+
+	services := make([]*discovery.Service, 0, len(versions))
+	for _, version := range versions {
+		svc := &discovery.Service{Name: name, Version: version}
+		for _, node := range e.versions[version] {
+			svc.Nodes = append(svc.Nodes, copyInstance(node))
+		}
+		services = append(services, svc)
+	}
+	return services, nil
+}
+
+// ListServices returns the names of the cached services
+func (r *Registry) ListServices() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.services))
+	for name, e := range r.services {
+		if len(e.versions) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Stop stops the watcher and waits for the last snapshot to be written
+func (r *Registry) Stop() {
+	select {
+	case <-r.exit:
+		return
+	default:
+		close(r.exit)
+	}
+	r.watcher.Stop()
+	<-r.done
+	r.mu.Lock()
+	if r.expiry != nil {
+		r.expiry.Stop()
+	}
+	r.mu.Unlock()
+}
+
+func (r *Registry) run() {
+	defer close(r.done)
+	for {
+		res, err := r.watcher.Next()
+		if err != nil {
+			// stopped, keep serving from the cache
+			return
+		}
+		r.startExpiry()
+		if name, ok := r.apply(res); ok {
+			r.save(name)
+		}
+	}
+}
+
+// startExpiry starts the expiry of the snapshot once the watcher answers,
+// the snapshot is served as long as the agent is unreachable
+func (r *Registry) startExpiry() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.expiry == nil {
+		r.expiry = time.AfterFunc(r.options.SnapshotExpiry, r.expire)
+	}
+}
+
+// expire drops the snapshot versions the watcher has not reported,
+// e.g. of the services deregistered while the process was down
+func (r *Registry) expire() {
+	var names []string
+	r.mu.Lock()
+	for name, e := range r.services {
+		if len(e.snapshot) == 0 {
+			continue
+		}
+		for version := range e.snapshot {
+			delete(e.versions, version)
+		}
+		e.snapshot = nil
+		if len(e.versions) == 0 {
+			delete(r.services, name)
+		}
+		names = append(names, name)
+	}
+	r.mu.Unlock()
+	sort.Strings(names)
+	for _, name := range names {
+		r.save(name)
+	}
+}
+
+// save persists a service and reports the errors
+func (r *Registry) save(name string) {
+	if err := r.persist(name); err != nil && r.options.OnError != nil {
+		r.options.OnError(err)
+	}
+}
+
+// apply merges a watcher result into the cache and returns the changed service
+func (r *Registry) apply(res *watcher.Result) (string, bool) {
+	if res == nil || res.Service == nil || res.Service.Name == "" {
+		return "", false
+	}
+	svc := res.Service
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.services[svc.Name]
+	if !ok {
+		e = &entry{versions: make(map[string][]*discovery.DefaultServiceInstance)}
+		r.services[svc.Name] = e
+	}
+
+	switch res.Action {
+	case "create", "update":
+		if len(svc.Nodes) == 0 {
+			return svc.Name, res.Action == "update"
+		}
+		nodes := make([]*discovery.DefaultServiceInstance, 0, len(svc.Nodes))
+		for _, node := range svc.Nodes {
+			nodes = append(nodes, toInstance(node))
+		}
+		e.versions[svc.Version] = nodes
+		// the watcher reports all the versions of a service together,
+		// the snapshot versions it reported are added back by the results that follow
+		for version := range e.snapshot {
+			if version != svc.Version {
+				delete(e.versions, version)
+			}
+		}
+		e.snapshot = nil
+	case "delete":
+		delete(e.snapshot, svc.Version)
+		if len(svc.Nodes) == 0 {
+			if svc.Version == "" {
+				delete(r.services, svc.Name)
+			} else {
+				delete(e.versions, svc.Version)
+			}
+			return svc.Name, true
+		}
+		var nodes []*discovery.DefaultServiceInstance
+		for _, node := range e.versions[svc.Version] {
+			var removed bool
+			for _, del := range svc.Nodes {
+				if del.GetId() == node.GetId() {
+					removed = true
+					break
+				}
+			}
+			if !removed {
+				nodes = append(nodes, node)
+			}
+		}
+		if len(nodes) == 0 {
+			delete(e.versions, svc.Version)
+		} else {
+			e.versions[svc.Version] = nodes
+		}
+	default:
+		return "", false
+	}
+	return svc.Name, true
+}
+
+func (r *Registry) load() error {
+	if r.options.Dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(r.options.Dir, 0o755); err != nil {
+		return err
+	}
+	files, err := filepath.Glob(filepath.Join(r.options.Dir, "*"+snapshotExt))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		buff, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		var s snapshot
+		if err = json.Unmarshal(buff, &s); err != nil {
+			// skip broken snapshots, the watcher will refresh them
+			continue
+		}
+		if s.Name == "" || len(s.Versions) == 0 {
+			continue
+		}
+		e := &entry{versions: s.Versions, snapshot: make(map[string]bool, len(s.Versions))}
+		for version := range s.Versions {
+			e.snapshot[version] = true
+		}
+		r.services[s.Name] = e
+	}
+	return nil
+}
+
+// persist writes the snapshot of a service, or removes it when the service is gone
+func (r *Registry) persist(name string) error {
+	if r.options.Dir == "" {
+		return nil
+	}
+	file := filepath.Join(r.options.Dir, snapshotFile(name))
+	r.persistMu.Lock()
+	defer r.persistMu.Unlock()
+
+	r.mu.RLock()
+	e, ok := r.services[name]
+	var s snapshot
+	if ok && len(e.versions) > 0 {
+		s = snapshot{Name: name, Versions: e.versions}
+	}
+	buff, err := json.Marshal(&s)
+	r.mu.RUnlock()
+	if err != nil {
+		return errors.Wrapf(err, "persist service error[name=%s]", name)
+	}
+
+	if s.Name == "" {
+		if err = os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "persist service error[name=%s]", name)
+		}
+		return nil
+	}
+
+	tmp := file + ".tmp"
+	if err = os.WriteFile(tmp, buff, 0o644); err == nil {
+		err = os.Rename(tmp, file)
+	}
+	return errors.Wrapf(err, "persist service error[name=%s]", name)
+}
+
+// snapshotFile returns a file name safe for any service name
+func snapshotFile(name string) string {
+	return strings.NewReplacer("/", "_", "\\", "_", ":", "_").Replace(name) + snapshotExt
+}
+
+func toInstance(node discovery.ServiceInstance) *discovery.DefaultServiceInstance {
+	if ins, ok := node.(*discovery.DefaultServiceInstance); ok {
+		return copyInstance(ins)
+	}
+	return &discovery.DefaultServiceInstance{
+		Id:          node.GetId(),
+		ServiceName: node.GetServiceName(),
+		Host:        node.GetHost(),
+		Port:        node.GetPort(),
+		ClusterName: node.GetClusterName(),
+		GroupName:   node.GetGroupName(),
+		Tags:        append([]string(nil), node.GetTags()...),
+		Enable:      node.IsEnable(),
+		Healthy:     node.IsHealthy(),
+		Weight:      node.GetWeight(),
+		Metadata:    node.GetMetadata(),
+	}
+}
+
+func copyInstance(ins *discovery.DefaultServiceInstance) *discovery.DefaultServiceInstance {
+	n := new(discovery.DefaultServiceInstance)
+	*n = *ins
+	n.Tags = append([]string(nil), ins.Tags...)
+	if ins.Metadata != nil {
+		n.Metadata = make(map[string]string, len(ins.Metadata))
+		for k, v := range ins.Metadata {
+			n.Metadata[k] = v
+		}
+	}
+	return n
+}
@@ -0,0 +1,230 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/donetkit/contrib_discovery/consul"
+	"github.com/donetkit/contrib_discovery/consultest"
+	"github.com/donetkit/contrib_discovery/discovery"
+	"github.com/donetkit/contrib_discovery/watcher"
+)
+
+// fakeWatcher returns the results sent on its channel
+type fakeWatcher struct {
+	results chan *watcher.Result
+	exit    chan struct{}
+}
+
+func newFakeWatcher() *fakeWatcher {
+	return &fakeWatcher{results: make(chan *watcher.Result), exit: make(chan struct{})}
+}
+
+func (w *fakeWatcher) Next() (*watcher.Result, error) {
+	select {
+	case r := <-w.results:
+		return r, nil
+	case <-w.exit:
+		return nil, errors.New("watcher stopped")
+	}
+}
+
+func (w *fakeWatcher) Stop() {
+	select {
+	case <-w.exit:
+	default:
+		close(w.exit)
+	}
+}
+
+// send delivers a result of svc, the previous result is applied when it returns
+func (w *fakeWatcher) send(action string, version string, ids ...string) {
+	svc := &discovery.Service{Name: "svc", Version: version}
+	for _, id := range ids {
+		svc.Nodes = append(svc.Nodes, &discovery.DefaultServiceInstance{Id: id, ServiceName: "svc", Enable: true, Healthy: true})
+	}
+	w.results <- &watcher.Result{Action: action, Service: svc}
+}
+
+// sync waits until the results sent so far are applied
+func (w *fakeWatcher) sync() {
+	w.results <- &watcher.Result{}
+}
+
+func expectVersions(t *testing.T, r *Registry, want map[string]int) {
+	t.Helper()
+	services, err := r.GetService("svc")
+	if len(want) == 0 {
+		if !errors.Is(err, discovery.ErrServiceNotFound) {
+			t.Fatalf("GetService = %v, want %v", err, discovery.ErrServiceNotFound)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]int, len(services))
+	for _, svc := range services {
+		got[svc.Version] = len(svc.Nodes)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("versions = %v, want %v", got, want)
+	}
+	for version, n := range want {
+		if got[version] != n {
+			t.Fatalf("versions = %v, want %v", got, want)
+		}
+	}
+}
+
+// newConsulClient returns a client of the test agent registering an instance of svc
+func newConsulClient(t *testing.T, server *consultest.Server, opts ...discovery.Option) *consul.Client {
+	t.Helper()
+	opts = append(append([]discovery.Option{
+		discovery.WithName("svc"),
+		discovery.WithCheckAddr("127.0.0.1"),
+		discovery.WithCheckPort(8080),
+	}, server.Options()...), opts...)
+	client, err := consul.New(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+	return client
+}
+
+// newConsulRegistry returns a registry fed by a consul watcher of the test agent
+func newConsulRegistry(t *testing.T, client *consul.Client, opts ...Option) *Registry {
+	t.Helper()
+	w, err := client.Watch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := New(w, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(r.Stop)
+	return r
+}
+
+// eventually waits until the versions of svc are want
+func eventually(t *testing.T, r *Registry, name string, want map[string]int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got := make(map[string]int)
+		services, _ := r.GetService(name)
+		for _, svc := range services {
+			got[svc.Version] = len(svc.Nodes)
+		}
+		if reflect.DeepEqual(got, want) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("versions of %s = %v, want %v", name, got, want)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// seed registers svc@1.0.0 a, svc@2.0.0 b and other@1.0.0 c, and writes their snapshot to dir
+func seed(t *testing.T, server *consultest.Server, dir string) (a, b, c *consul.Client) {
+	t.Helper()
+	a = newConsulClient(t, server, discovery.WithId("a"), discovery.WithVersion("1.0.0"))
+	b = newConsulClient(t, server, discovery.WithId("b"), discovery.WithVersion("2.0.0"))
+	c = newConsulClient(t, server, discovery.WithId("c"), discovery.WithName("other"), discovery.WithVersion("1.0.0"))
+	for _, client := range []*consul.Client{a, b, c} {
+		if err := client.Register(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := newConsulRegistry(t, a, WithDir(dir))
+	eventually(t, r, "svc", map[string]int{"1.0.0": 1, "2.0.0": 1})
+	eventually(t, r, "other", map[string]int{"1.0.0": 1})
+	r.Stop()
+	return a, b, c
+}
+
+func TestStaleSnapshot(t *testing.T) {
+	server := consultest.NewServer()
+	t.Cleanup(server.Close)
+	dir := t.TempDir()
+	a, b, _ := seed(t, server, dir)
+
+	// svc@2.0.0 goes away while the process is down, the watcher never sends a delete for it
+	if err := b.Deregister(); err != nil {
+		t.Fatal(err)
+	}
+	r := newConsulRegistry(t, a, WithDir(dir), WithSnapshotExpiry(time.Hour))
+	eventually(t, r, "svc", map[string]int{"1.0.0": 1})
+	eventually(t, r, "other", map[string]int{"1.0.0": 1})
+}
+
+func TestSnapshotExpiry(t *testing.T) {
+	server := consultest.NewServer()
+	t.Cleanup(server.Close)
+	dir := t.TempDir()
+	a, _, c := seed(t, server, dir)
+
+	// the watcher never reports other once it is gone
+	if err := c.Deregister(); err != nil {
+		t.Fatal(err)
+	}
+	r := newConsulRegistry(t, a, WithDir(dir), WithSnapshotExpiry(100*time.Millisecond))
+	eventually(t, r, "other", map[string]int{})
+	eventually(t, r, "svc", map[string]int{"1.0.0": 1, "2.0.0": 1})
+	r.Stop()
+	if _, err := os.Stat(filepath.Join(dir, snapshotFile("other"))); !os.IsNotExist(err) {
+		t.Fatalf("snapshot of an expired service: %v", err)
+	}
+}
+
+func TestSnapshotAgentDown(t *testing.T) {
+	server := consultest.NewServer()
+	dir := t.TempDir()
+	a, _, _ := seed(t, server, dir)
+	server.Close()
+
+	// the snapshot does not expire while the agent is unreachable
+	r := newConsulRegistry(t, a, WithDir(dir), WithSnapshotExpiry(10*time.Millisecond))
+	time.Sleep(100 * time.Millisecond)
+	expectVersions(t, r, map[string]int{"1.0.0": 1, "2.0.0": 1})
+}
+
+func TestPersistError(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "snapshots")
+	errs := make(chan error, 1)
+	w := newFakeWatcher()
+	r, err := New(w, WithDir(dir), WithOnError(func(err error) {
+		errs <- err
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	// the snapshot dir is replaced by a file
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dir, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	w.send("create", "1.0.0", "a")
+
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Fatal("nil error")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("persist error not reported")
+	}
+	expectVersions(t, r, map[string]int{"1.0.0": 1})
+}
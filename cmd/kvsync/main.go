@@ -0,0 +1,148 @@
+// Command kvsync mirrors a KV prefix from a Consul cluster to other clusters.
+//
+//	kvsync -source 127.0.0.1:8500 -target 192.168.5.110:18500 -prefix app/gateway/ -delete -watch
+//
+// The modify indexes of the synced keys are kept in the -state file, a target key changed since the previous run
+// is reported as a conflict and the command exits with code 2.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/donetkit/contrib_discovery/consul"
+	"github.com/donetkit/contrib_discovery/discovery"
+	"github.com/donetkit/contrib_discovery/kvsync"
+)
+
+type list []string
+
+func (l *list) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *list) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout))
+}
+
+// run syncs as told by the arguments and returns the exit code
+func run(args []string, stdout io.Writer) int {
+	var targets, include, exclude list
+	fs := flag.NewFlagSet("kvsync", flag.ContinueOnError)
+	source := fs.String("source", "127.0.0.1:8500", "source consul address")
+	token := fs.String("token", "", "acl token of the source and targets")
+	prefix := fs.String("prefix", "", "mirrored key prefix")
+	fs.Var(&targets, "target", "target consul address, repeatable")
+	fs.Var(&include, "include", "include pattern relative to the prefix, repeatable")
+	fs.Var(&exclude, "exclude", "exclude pattern relative to the prefix, repeatable")
+	dryRun := fs.Bool("dry-run", false, "print the changes without writing the targets")
+	del := fs.Bool("delete", false, "delete the target keys missing from the source")
+	force := fs.Bool("force", false, "overwrite the target keys changed since the last sync")
+	watch := fs.Bool("watch", false, "keep syncing on every change of the source")
+	state := fs.String("state", ".kvsync-state.json", "file keeping the indexes of the last sync, blank to disable")
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+
+	if len(targets) == 0 {
+		log.Print("at least one -target is required")
+		return 1
+	}
+
+	src, err := newClient(*source, *token)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	defer src.Close()
+	var syncTargets []kvsync.Target
+	for _, addr := range targets {
+		client, err := newClient(addr, *token)
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		defer client.Close()
+		syncTargets = append(syncTargets, kvsync.Target{Name: addr, KV: client})
+	}
+
+	opts := []kvsync.Option{
+		kvsync.WithPrefix(*prefix),
+		kvsync.WithInclude(include...),
+		kvsync.WithExclude(exclude...),
+		kvsync.WithStateFile(*state),
+		kvsync.WithOnReport(func(r *kvsync.Report) {
+			fmt.Fprint(stdout, r)
+		}),
+	}
+	if *dryRun {
+		opts = append(opts, kvsync.WithDryRun())
+	}
+	if *del {
+		opts = append(opts, kvsync.WithDelete())
+	}
+	if *force {
+		opts = append(opts, kvsync.WithForce())
+	}
+	syncer, err := kvsync.New(src, syncTargets, opts...)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if *watch {
+		if err = syncer.Run(ctx); err != nil && ctx.Err() == nil {
+			log.Print(err)
+			return 1
+		}
+		return 0
+	}
+
+	reports, err := syncer.Sync(ctx)
+	var conflicts int
+	for _, r := range reports {
+		fmt.Fprint(stdout, r)
+		conflicts += len(r.Conflicts)
+	}
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	if conflicts > 0 {
+		return 2
+	}
+	return 0
+}
+
+func newClient(addr string, token string) (*consul.Client, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %q: %v", addr, err)
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %q: %v", addr, err)
+	}
+	return consul.New(discovery.WithRegisterAddr(host), discovery.WithRegisterPort(p), discovery.WithToken(token))
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/donetkit/contrib_discovery/consul"
+	"github.com/donetkit/contrib_discovery/consultest"
+)
+
+func newConsul(t *testing.T, server *consultest.Server) *consul.Client {
+	t.Helper()
+	client, err := consul.New(server.Options()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+	return client
+}
+
+func TestRunConflict(t *testing.T) {
+	source, target := consultest.NewServer(), consultest.NewServer()
+	defer source.Close()
+	defer target.Close()
+	src, dst := newConsul(t, source), newConsul(t, target)
+	args := []string{
+		"-source", fmt.Sprintf("%s:%d", source.Host(), source.Port()),
+		"-target", fmt.Sprintf("%s:%d", target.Host(), target.Port()),
+		"-prefix", "app/",
+		"-state", filepath.Join(t.TempDir(), "state.json"),
+	}
+
+	if err := src.Set("app/a", "1"); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if code := run(args, &out); code != 0 {
+		t.Fatalf("run = %d, want 0\n%s", code, out.String())
+	}
+	if value, err := dst.Get("app/a"); err != nil || string(value) != "1" {
+		t.Fatalf("target app/a = %q, %v, want 1", value, err)
+	}
+
+	// a second run does not overwrite the edit made on the target
+	if err := dst.Set("app/a", "edited"); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.Set("app/a", "2"); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if code := run(args, &out); code != 2 {
+		t.Fatalf("run = %d, want 2\n%s", code, out.String())
+	}
+	if value, err := dst.Get("app/a"); err != nil || string(value) != "edited" {
+		t.Fatalf("target app/a = %q, %v, want edited", value, err)
+	}
+}
@@ -0,0 +1,162 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/donetkit/contrib_discovery/discovery"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	"sync"
+	"sync/atomic"
+)
+
+// Validator is implemented by configurations checking themselves before being swapped in
+type Validator interface {
+	Validate() error
+}
+
+// Config is a Go struct bound to a KV key or prefix, it is replaced atomically on change
+type Config[T any] struct {
+	kv      discovery.KV
+	key     string
+	options Options
+	value   atomic.Pointer[T]
+
+	mu       sync.RWMutex
+	raw      string
+	onChange []func(old, new *T)
+	onError  []func(err error)
+}
+
+// New loads the key (or prefix for Flat) into a new T
+func New[T any](kv discovery.KV, key string, opts ...Option) (*Config[T], error) {
+	c := &Config[T]{
+		kv:      kv,
+		key:     key,
+		options: newOptions(key, opts),
+	}
+	value, raw, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+	c.value.Store(value)
+	c.raw = raw
+	return c, nil
+}
+
+// Get returns the current value, it must not be modified
+func (c *Config[T]) Get() *T {
+	return c.value.Load()
+}
+
+// OnChange adds a hook called after a new value is swapped in
+func (c *Config[T]) OnChange(fn func(old, new *T)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onChange = append(c.onChange, fn)
+}
+
+// OnError adds a hook called when a reload fails, the current value is kept
+func (c *Config[T]) OnError(fn func(err error)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onError = append(c.onError, fn)
+}
+
+// Reload loads the key and swaps in the new value if the stored value changed.
+// The load, compare and swap are done under the lock, so concurrent reloads never swap in an older value.
+func (c *Config[T]) Reload() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	value, raw, err := c.load()
+	if err != nil {
+		for _, fn := range c.onError {
+			fn(err)
+		}
+		return err
+	}
+	if raw == c.raw {
+		return nil
+	}
+	c.raw = raw
+	old := c.value.Swap(value)
+	for _, fn := range c.onChange {
+		fn(old, value)
+	}
+	return nil
+}
+
+// Watch reloads the value on every change until ctx is done, the KV must implement discovery.KVWatcher
+func (c *Config[T]) Watch(ctx context.Context) error {
+	watcher, ok := c.kv.(discovery.KVWatcher)
+	if !ok {
+		return errors.New("kv does not support watch")
+	}
+
+	var updates <-chan discovery.KVUpdate
+	var err error
+	if c.options.Format == Flat {
+		updates, err = watcher.WatchPrefix(ctx, c.key)
+	} else {
+		updates, err = watcher.WatchKey(ctx, c.key)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "watch config error[key=%s]", c.key)
+	}
+
+	go func() {
+		for range updates {
+			// coalesce the updates of one change
+			for drained := false; !drained; {
+				select {
+				case _, ok := <-updates:
+					if !ok {
+						return
+					}
+				default:
+					drained = true
+				}
+			}
+			_ = c.Reload()
+		}
+	}()
+	return nil
+}
+
+// load decodes and validates the stored value, raw is the stored form used to detect changes
+func (c *Config[T]) load() (*T, string, error) {
+	value := new(T)
+	var raw string
+	switch c.options.Format {
+	case Flat:
+		values, err := c.kv.List(c.key)
+		if err != nil {
+			return nil, "", errors.Wrapf(err, "load config error[key=%s]", c.key)
+		}
+		if err = decodeFlat(c.key, values, value); err != nil {
+			return nil, "", errors.Wrapf(err, "decode config error[key=%s]", c.key)
+		}
+		raw = flatRaw(values)
+	default:
+		buff, err := c.kv.Get(c.key)
+		if err != nil {
+			return nil, "", errors.Wrapf(err, "load config error[key=%s]", c.key)
+		}
+		if c.options.Format == YAML {
+			err = yaml.Unmarshal(buff, value)
+		} else {
+			err = json.Unmarshal(buff, value)
+		}
+		if err != nil {
+			return nil, "", errors.Wrapf(err, "decode config error[key=%s]", c.key)
+		}
+		raw = string(buff)
+	}
+
+	if v, ok := interface{}(value).(Validator); ok {
+		if err := v.Validate(); err != nil {
+			return nil, "", errors.Wrapf(err, "validate config error[key=%s]", c.key)
+		}
+	}
+	return value, raw, nil
+}
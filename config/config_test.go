@@ -0,0 +1,195 @@
+package config_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/donetkit/contrib_discovery/config"
+	"github.com/donetkit/contrib_discovery/memory"
+)
+
+type server struct {
+	Name    string        `json:"name" yaml:"name"`
+	Port    int           `json:"port" yaml:"port"`
+	Timeout time.Duration `json:"timeout" yaml:"timeout"`
+	DB      struct {
+		Host string `json:"host" yaml:"host" kv:"host"`
+	} `json:"db" yaml:"db"`
+}
+
+func (s *server) Validate() error {
+	if s.Port <= 0 {
+		return errors.New("port must be positive")
+	}
+	return nil
+}
+
+func newKV(t *testing.T, values map[string]string) *memory.Client {
+	t.Helper()
+	kv, err := memory.NewWithRegistry(memory.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range values {
+		if err := kv.Set(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return kv
+}
+
+func TestDecode(t *testing.T) {
+	kv := newKV(t, map[string]string{
+		"app/server":         `{"name":"api","port":8080,"timeout":3000000000,"db":{"host":"db1"}}`,
+		"app/server.yaml":    "name: api\nport: 8080\ntimeout: 3s\ndb:\n  host: db1\n",
+		"app/flat/name":      "api",
+		"app/flat/port":      "8080",
+		"app/flat/timeout":   "3s",
+		"app/flat/db/host":   "db1",
+		"app/flat/unknown/x": "ignored",
+	})
+	for _, key := range []string{"app/server", "app/server.yaml", "app/flat/"} {
+		c, err := config.New[server](kv, key)
+		if err != nil {
+			t.Fatalf("New(%s) = %v", key, err)
+		}
+		got := c.Get()
+		if got.Name != "api" || got.Port != 8080 || got.Timeout != 3*time.Second || got.DB.Host != "db1" {
+			t.Fatalf("New(%s) = %+v", key, got)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	kv := newKV(t, map[string]string{"app/server": `{"port":0}`})
+	if _, err := config.New[server](kv, "app/server"); err == nil {
+		t.Fatal("New with an invalid value succeeded")
+	}
+
+	if err := kv.Set("app/server", `{"port":1}`); err != nil {
+		t.Fatal(err)
+	}
+	c, err := config.New[server](kv, "app/server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errs []error
+	c.OnError(func(err error) {
+		errs = append(errs, err)
+	})
+	c.OnChange(func(old, new *server) {
+		t.Fatalf("OnChange(%+v, %+v) on an invalid value", old, new)
+	})
+	if err := kv.Set("app/server", `{"port":-1}`); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Reload(); err == nil {
+		t.Fatal("Reload with an invalid value succeeded")
+	}
+	if len(errs) != 1 {
+		t.Fatalf("OnError calls = %d, want 1", len(errs))
+	}
+	if c.Get().Port != 1 {
+		t.Fatalf("Get = %+v, want the previous value", c.Get())
+	}
+}
+
+func TestOnChange(t *testing.T) {
+	kv := newKV(t, map[string]string{"app/server": `{"port":1}`})
+	c, err := config.New[server](kv, "app/server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	type change struct{ old, new int }
+	var changes []change
+	c.OnChange(func(old, new *server) {
+		changes = append(changes, change{old.Port, new.Port})
+	})
+
+	if err := c.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("OnChange called without a change: %v", changes)
+	}
+	if err := kv.Set("app/server", `{"port":2}`); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0] != (change{1, 2}) {
+		t.Fatalf("changes = %v, want [{1 2}]", changes)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	kv := newKV(t, map[string]string{"app/flat/port": "1"})
+	c, err := config.New[server](kv, "app/flat/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed := make(chan int, 10)
+	c.OnChange(func(old, new *server) {
+		changed <- new.Port
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := c.Watch(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := kv.Set("app/flat/port", "2"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case port := <-changed:
+		if port != 2 {
+			t.Fatalf("OnChange port = %d, want 2", port)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnChange not called")
+	}
+	if c.Get().Port != 2 {
+		t.Fatalf("Get = %+v, want port 2", c.Get())
+	}
+}
+
+func TestConcurrentReload(t *testing.T) {
+	kv := newKV(t, map[string]string{"app/server": `{"port":1}`})
+	c, err := config.New[server](kv, "app/server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every value swapped in is newer than the previous one
+	c.OnChange(func(old, new *server) {
+		if new.Port <= old.Port {
+			t.Errorf("OnChange(%d, %d) swapped in an older value", old.Port, new.Port)
+		}
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				_ = c.Reload()
+			}
+		}()
+	}
+	for port := 2; port <= 50; port++ {
+		if err := kv.Set("app/server", fmt.Sprintf(`{"port":%d}`, port)); err != nil {
+			t.Fatal(err)
+		}
+		_ = c.Reload()
+	}
+	wg.Wait()
+	if c.Get().Port != 50 {
+		t.Fatalf("Get = %+v, want port 50", c.Get())
+	}
+}
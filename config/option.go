@@ -0,0 +1,46 @@
+package config
+
+import "strings"
+
+// Format of the values stored in KV
+type Format int
+
+const (
+	// JSON decodes the value of the key as JSON
+	JSON Format = iota
+	// YAML decodes the value of the key as YAML
+	YAML
+	// Flat maps the keys under a prefix to the struct fields, e.g. prefix/db/host to DB.Host
+	Flat
+)
+
+// Options for binding
+type Options struct {
+	Format Format
+}
+
+// Option for binding
+type Option func(*Options)
+
+// WithFormat set format function, the format defaults to YAML for .yaml/.yml keys, Flat for keys ending with / and JSON otherwise
+func WithFormat(format Format) Option {
+	return func(o *Options) {
+		o.Format = format
+	}
+}
+
+func newOptions(key string, opts []Option) Options {
+	var o Options
+	switch {
+	case strings.HasSuffix(key, ".yaml"), strings.HasSuffix(key, ".yml"):
+		o.Format = YAML
+	case strings.HasSuffix(key, "/"):
+		o.Format = Flat
+	default:
+		o.Format = JSON
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
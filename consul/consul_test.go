@@ -0,0 +1,62 @@
+package consul_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/donetkit/contrib_discovery/consul"
+	"github.com/donetkit/contrib_discovery/consultest"
+	"github.com/donetkit/contrib_discovery/discovery"
+	"github.com/donetkit/contrib_discovery/watcher"
+)
+
+// newServer starts a fake agent closed when the test ends, after the clients and watchers
+func newServer(t *testing.T) *consultest.Server {
+	t.Helper()
+	server := consultest.NewServer()
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newClient returns a client of the fake agent for an instance of svc
+func newClient(t *testing.T, server *consultest.Server, opts ...discovery.Option) *consul.Client {
+	t.Helper()
+	opts = append(append([]discovery.Option{
+		discovery.WithName("svc"),
+		discovery.WithCheckAddr("127.0.0.1"),
+		discovery.WithCheckPort(8080),
+	}, server.Options()...), opts...)
+	client, err := consul.New(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+	return client
+}
+
+// eventually waits until cond holds
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// nextEvent returns the next event of a watcher
+func nextEvent(t *testing.T, events <-chan watcher.Event) watcher.Event {
+	t.Helper()
+	select {
+	case e, ok := <-events:
+		if !ok {
+			t.Fatal("events closed")
+		}
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event")
+	}
+	return watcher.Event{}
+}
@@ -0,0 +1,210 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+	consulApi "github.com/hashicorp/consul/api"
+	"github.com/pkg/errors"
+)
+
+var _ discovery.LeaderElector = (*LeaderElector)(nil)
+
+// LeaderElector elects a leader among the instances of the service with a lock held by a session
+// bound to the service's health check, the leader steps down when its check goes critical
+type LeaderElector struct {
+	client  *Client
+	key     string
+	options discovery.LockOptions
+
+	campaignLocker sync.Mutex
+	mu             sync.RWMutex
+	leader         bool
+	session        string
+	lock           *consulApi.Lock
+}
+
+// NewLeaderElector returns an elector on the key, the service must be registered before Campaign
+func (s *Client) NewLeaderElector(key string, opts ...discovery.LockOption) *LeaderElector {
+	return &LeaderElector{
+		client:  s,
+		key:     key,
+		options: discovery.NewLockOptions(opts...),
+	}
+}
+
+// Campaign blocks until the instance is elected or ctx is done
+func (e *LeaderElector) Campaign(ctx context.Context) error {
+	e.campaignLocker.Lock()
+	defer e.campaignLocker.Unlock()
+	if e.IsLeader() {
+		return nil
+	}
+
+	entry := &consulApi.SessionEntry{
+		Name:          fmt.Sprintf("%s leader %s", e.client.options.Name, e.key),
+		Behavior:      consulApi.SessionBehaviorRelease,
+		NodeChecks:    []string{"serfHealth"},
+		ServiceChecks: []consulApi.ServiceCheck{{ID: e.client.serviceCheckId()}},
+	}
+	if e.options.LockDelay >= 0 {
+		entry.LockDelay = lockDelay(e.options.LockDelay)
+	}
+	session, _, err := e.client.client.Session().Create(entry, (&consulApi.WriteOptions{}).WithContext(ctx))
+	if err != nil {
+		return errors.Wrapf(err, "create session error[key=%s]", e.key)
+	}
+
+	value := e.options.Value
+	if value == nil {
+		value, err = json.Marshal(e.client.instance())
+		if err != nil {
+			e.destroySession(session)
+			return err
+		}
+	}
+	lockOpts := &consulApi.LockOptions{
+		Key:         e.key,
+		Value:       value,
+		Session:     session,
+		LockTryOnce: e.options.TryOnce,
+	}
+	if e.options.TryOnce {
+		lockOpts.LockWaitTime = tryOnceWaitTime
+	}
+	lock, err := e.client.client.LockOpts(lockOpts)
+	if err != nil {
+		e.destroySession(session)
+		return errors.Wrapf(err, "create lock error[key=%s]", e.key)
+	}
+
+	stop, cancel := stopChan(ctx)
+	lost, err := lock.Lock(stop)
+	cancel()
+	if err != nil || lost == nil {
+		e.destroySession(session)
+		if err == nil {
+			err = ctx.Err()
+		}
+		if err == nil {
+			err = discovery.ErrLockNotHeld
+		}
+		return errors.Wrapf(err, "campaign error[key=%s]", e.key)
+	}
+
+	e.mu.Lock()
+	e.leader = true
+	e.session = session
+	e.lock = lock
+	e.mu.Unlock()
+	go e.stepDownOnLost(lock, lost)
+	return nil
+}
+
+// Resign gives up the leadership
+func (e *LeaderElector) Resign() error {
+	lock, session, ok := e.stepDown(nil)
+	if !ok {
+		return nil
+	}
+	err := lock.Unlock()
+	e.destroySession(session)
+	if err != nil && err != consulApi.ErrLockNotHeld {
+		return errors.Wrapf(err, "resign error[key=%s]", e.key)
+	}
+	return nil
+}
+
+// IsLeader reports whether the instance is the leader
+func (e *LeaderElector) IsLeader() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.leader
+}
+
+// Observe returns the current leader on every change, nil when there is no leader
+func (e *LeaderElector) Observe(ctx context.Context) <-chan discovery.ServiceInstance {
+	ch := make(chan discovery.ServiceInstance, 1)
+	go func() {
+		defer close(ch)
+		var (
+			index   uint64
+			session = "-"
+		)
+		for {
+			q := (&consulApi.QueryOptions{WaitIndex: index}).WithContext(ctx)
+			pair, meta, err := e.client.client.KV().Get(e.key, q)
+			if err != nil {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(time.Second):
+					continue
+				}
+			}
+			if meta.LastIndex < index {
+				// the index went backwards, start over
+				index = 0
+			} else {
+				index = meta.LastIndex
+			}
+
+			var current string
+			var leader discovery.ServiceInstance
+			if pair != nil && pair.Session != "" {
+				current = pair.Session
+				ins := &discovery.DefaultServiceInstance{}
+				if json.Unmarshal(pair.Value, ins) == nil {
+					leader = ins
+				} else {
+					leader = &discovery.DefaultServiceInstance{Metadata: map[string]string{"value": string(pair.Value)}}
+				}
+			}
+			if current == session {
+				continue
+			}
+			session = current
+
+			select {
+			case <-ctx.Done():
+				return
+			case ch <- leader:
+			}
+		}
+	}()
+	return ch
+}
+
+// stepDownOnLost clears the leadership when the lock is lost, e.g. the service's check went critical
+func (e *LeaderElector) stepDownOnLost(lock *consulApi.Lock, lost <-chan struct{}) {
+	<-lost
+	if _, session, ok := e.stepDown(lock); ok {
+		e.destroySession(session)
+	}
+}
+
+// stepDown clears the leadership held with lock, or with any lock when nil, and returns the lock and session to release.
+// The agent is called by the callers once e.mu is released, so a slow agent does not block IsLeader.
+func (e *LeaderElector) stepDown(lock *consulApi.Lock) (*consulApi.Lock, string, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.leader || (lock != nil && e.lock != lock) {
+		// resigned already
+		return nil, "", false
+	}
+	lock, session := e.lock, e.session
+	e.leader = false
+	e.lock, e.session = nil, ""
+	return lock, session, true
+}
+
+func (e *LeaderElector) destroySession(session string) {
+	if session == "" {
+		return
+	}
+	_, _ = e.client.client.Session().Destroy(session, nil)
+}
@@ -0,0 +1,123 @@
+package consul_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/donetkit/contrib_discovery/consul"
+	"github.com/donetkit/contrib_discovery/consultest"
+	"github.com/donetkit/contrib_discovery/discovery"
+	consulApi "github.com/hashicorp/consul/api"
+)
+
+const leaderKey = "svc/leader"
+
+// newCandidate registers an instance of svc and returns its elector
+func newCandidate(t *testing.T, server *consultest.Server, id string, opts ...discovery.LockOption) *consul.LeaderElector {
+	t.Helper()
+	client := newClient(t, server, discovery.WithId(id))
+	if err := client.Register(); err != nil {
+		t.Fatal(err)
+	}
+	e := client.NewLeaderElector(leaderKey, opts...)
+	t.Cleanup(func() {
+		_ = e.Resign()
+	})
+	return e
+}
+
+func TestCampaign(t *testing.T) {
+	server := newServer(t)
+	a, b := newCandidate(t, server, "a"), newCandidate(t, server, "b", discovery.WithLockTryOnce())
+
+	if err := a.Campaign(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !a.IsLeader() {
+		t.Fatal("a is not the leader after Campaign")
+	}
+	if err := b.Campaign(context.Background()); err == nil {
+		t.Fatal("b won the campaign while a leads")
+	}
+	if b.IsLeader() {
+		t.Fatal("b is the leader while a leads")
+	}
+}
+
+func TestResign(t *testing.T) {
+	server := newServer(t)
+	a, b := newCandidate(t, server, "a"), newCandidate(t, server, "b")
+	if err := a.Campaign(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	elected := make(chan error, 1)
+	go func() {
+		elected <- b.Campaign(context.Background())
+	}()
+	if err := a.Resign(); err != nil {
+		t.Fatal(err)
+	}
+	if a.IsLeader() {
+		t.Fatal("a is the leader after Resign")
+	}
+	select {
+	case err := <-elected:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("b was not elected after a resigned")
+	}
+	if !b.IsLeader() {
+		t.Fatal("b is not the leader")
+	}
+}
+
+func TestObserve(t *testing.T) {
+	server := newServer(t)
+	a, b := newCandidate(t, server, "a"), newCandidate(t, server, "b")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	leaders := b.Observe(ctx)
+
+	next := func() discovery.ServiceInstance {
+		t.Helper()
+		select {
+		case leader := <-leaders:
+			return leader
+		case <-time.After(5 * time.Second):
+			t.Fatal("no leader reported")
+		}
+		return nil
+	}
+	if leader := next(); leader != nil {
+		t.Fatalf("leader = %s, want none", leader.GetId())
+	}
+	if err := a.Campaign(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if leader := next(); leader == nil || leader.GetId() != "a" || leader.GetServiceName() != "svc" {
+		t.Fatalf("leader = %v, want a", leader)
+	}
+	if err := a.Resign(); err != nil {
+		t.Fatal(err)
+	}
+	if leader := next(); leader != nil {
+		t.Fatalf("leader = %s after Resign, want none", leader.GetId())
+	}
+}
+
+func TestStepDownOnCriticalCheck(t *testing.T) {
+	server := newServer(t)
+	a := newCandidate(t, server, "a")
+	if err := a.Campaign(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	server.SetCheckStatus("a", consulApi.HealthCritical)
+	eventually(t, "a to step down", func() bool {
+		return !a.IsLeader()
+	})
+}
@@ -0,0 +1,100 @@
+package consul
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+	consulApi "github.com/hashicorp/consul/api"
+	"github.com/pkg/errors"
+)
+
+// startHeartbeat reports the CheckResponse status to the TTL check every interval until deregister
+func (s *Client) startHeartbeat() {
+	s.heartbeatLocker.Lock()
+	defer s.heartbeatLocker.Unlock()
+	if s.heartbeat != nil {
+		return
+	}
+	stop := make(chan struct{})
+	s.heartbeat = stop
+
+	go func() {
+		interval := time.Duration(s.options.IntervalTime) * time.Second / 2
+		if interval < time.Second {
+			interval = time.Second
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			s.updateTTL(stop)
+			select {
+			case <-stop:
+				return
+			case <-s.exit:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (s *Client) stopHeartbeat() {
+	s.heartbeatLocker.Lock()
+	defer s.heartbeatLocker.Unlock()
+	if s.heartbeat != nil {
+		close(s.heartbeat)
+		s.heartbeat = nil
+	}
+}
+
+// updateTTL reports the status to the TTL check, the service is registered again when the agent lost the check,
+// e.g. after an agent restart. The errors are passed to Config.OnHeartbeatError.
+func (s *Client) updateTTL(stop chan struct{}) {
+	err := s.passTTL()
+	if isCheckNotFound(err) {
+		err = s.reregister(stop)
+	}
+	if err != nil {
+		if s.options.OnHeartbeatError != nil {
+			s.options.OnHeartbeatError(errors.Wrapf(err, "update ttl error[id=%s]", s.serviceCheckId()))
+		}
+		return
+	}
+	// mark the check answered, so the self-check only goes stale when Consul is unreachable
+	s.options.CheckResponse.Result()
+}
+
+func (s *Client) passTTL() error {
+	status := s.options.CheckResponse.Status()
+	switch status {
+	case discovery.HealthPassing, discovery.HealthWarning, discovery.HealthCritical:
+	default:
+		status = discovery.HealthCritical
+	}
+	return s.client.Agent().UpdateTTL(s.serviceCheckId(), s.options.CheckResponse.Output(), status)
+}
+
+// reregister registers the service and reports the status again, unless Deregister stopped the heartbeat
+func (s *Client) reregister(stop chan struct{}) error {
+	s.heartbeatLocker.Lock()
+	defer s.heartbeatLocker.Unlock()
+	if s.heartbeat != stop {
+		return nil
+	}
+	if err := s.register(); err != nil {
+		return err
+	}
+	return s.passTTL()
+}
+
+// isCheckNotFound reports whether the agent does not know the check,
+// older agents answer 500 "CheckID ... does not have associated TTL"
+func isCheckNotFound(err error) bool {
+	var statusErr consulApi.StatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+	return statusErr.Code == http.StatusNotFound || strings.Contains(statusErr.Body, "does not have associated TTL")
+}
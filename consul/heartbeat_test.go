@@ -0,0 +1,48 @@
+package consul_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+)
+
+func TestHeartbeatReregister(t *testing.T) {
+	server := newServer(t)
+	errs := make(chan error, 10)
+	client := newClient(t, server, discovery.WithId("a"), discovery.WithCheckTTL(), discovery.WithIntervalTime(1),
+		discovery.WithOnHeartbeatError(func(err error) {
+			select {
+			case errs <- err:
+			default:
+			}
+		}))
+	if err := client.Register(); err != nil {
+		t.Fatal(err)
+	}
+	// the agent loses the service, e.g. on a restart
+	if err := newClient(t, server, discovery.WithId("a")).Deregister(); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := client.GetService(context.Background(), "svc"); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the heartbeat did not register the service again")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	server.Close()
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Fatal("nil heartbeat error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the heartbeat error was not reported")
+	}
+}
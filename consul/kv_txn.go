@@ -0,0 +1,101 @@
+package consul
+
+import (
+	"context"
+	"fmt"
+	"github.com/donetkit/contrib_discovery/discovery"
+	consulApi "github.com/hashicorp/consul/api"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+var _ discovery.TxnKV = (*Client)(nil)
+
+func (s *Client) CompareAndSet(ctx context.Context, key string, value string, index uint64) error {
+	p := &consulApi.KVPair{Key: key, Value: []byte(value), ModifyIndex: index}
+	ok, _, err := s.client.KV().CAS(p, (&consulApi.WriteOptions{}).WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.Wrapf(discovery.ErrConflict, "cas kv error[key=%s,index=%d]", key, index)
+	}
+	return nil
+}
+
+func (s *Client) DeleteCAS(ctx context.Context, key string, index uint64) error {
+	p := &consulApi.KVPair{Key: key, ModifyIndex: index}
+	ok, _, err := s.client.KV().DeleteCAS(p, (&consulApi.WriteOptions{}).WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.Wrapf(discovery.ErrConflict, "delete cas kv error[key=%s,index=%d]", key, index)
+	}
+	return nil
+}
+
+// Txn applies the operations with the Consul transaction endpoint
+func (s *Client) Txn(ctx context.Context, txn *discovery.Txn) ([]*discovery.KVPair, error) {
+	ops := make(consulApi.TxnOps, 0, len(txn.Ops))
+	for _, op := range txn.Ops {
+		var verb consulApi.KVOp
+		switch op.Verb {
+		case discovery.TxnGet:
+			verb = consulApi.KVGet
+		case discovery.TxnSet:
+			verb = consulApi.KVSet
+		case discovery.TxnDelete:
+			verb = consulApi.KVDelete
+		case discovery.TxnCheckIndex:
+			verb = consulApi.KVCheckIndex
+		case discovery.TxnCAS:
+			verb = consulApi.KVCAS
+		default:
+			return nil, errors.Errorf("unknown txn verb %q", op.Verb)
+		}
+		ops = append(ops, &consulApi.TxnOp{KV: &consulApi.KVTxnOp{
+			Verb:  verb,
+			Key:   op.Key,
+			Value: op.Value,
+			Index: op.Index,
+			Flags: op.Flags,
+		}})
+	}
+
+	ok, resp, _, err := s.client.Txn().Txn(ops, (&consulApi.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		var what []string
+		for _, e := range resp.Errors {
+			what = append(what, fmt.Sprintf("op %d: %s", e.OpIndex, e.What))
+		}
+		return nil, errors.Wrap(discovery.ErrTxnAborted, strings.Join(what, "; "))
+	}
+
+	// every operation but delete has a result, in the order of the operations
+	var results = make([]*consulApi.TxnResult, len(txn.Ops))
+	var next int
+	for i, op := range txn.Ops {
+		if op.Verb == discovery.TxnDelete {
+			continue
+		}
+		if next < len(resp.Results) {
+			results[i] = resp.Results[next]
+		}
+		next++
+	}
+	if next != len(resp.Results) {
+		return nil, errors.Errorf("txn results do not match the operations[ops=%d,results=%d,expected=%d]", len(txn.Ops), len(resp.Results), next)
+	}
+
+	var pairs []*discovery.KVPair
+	for i, op := range txn.Ops {
+		if op.Verb == discovery.TxnGet && results[i].KV != nil {
+			pairs = append(pairs, newKVPair(results[i].KV))
+		}
+	}
+	return pairs, nil
+}
@@ -0,0 +1,127 @@
+package consul
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+	consulApi "github.com/hashicorp/consul/api"
+)
+
+var _ discovery.KVWatcher = (*Client)(nil)
+
+// kvRetryTime is the wait before retrying a failed blocking query
+const kvRetryTime = time.Second
+
+// WatchKey sends the value of the key on every change using blocking queries
+func (s *Client) WatchKey(ctx context.Context, key string) (<-chan discovery.KVUpdate, error) {
+	ch := make(chan discovery.KVUpdate, 1)
+	go func() {
+		defer close(ch)
+		var index, modifyIndex uint64
+		// loaded is set after the first answer, a key missing at the start is sent as deleted
+		var exists, loaded bool
+		for {
+			q := (&consulApi.QueryOptions{WaitIndex: index}).WithContext(ctx)
+			pair, meta, err := s.client.KV().Get(key, q)
+			if err != nil {
+				if !sleep(ctx, kvRetryTime) {
+					return
+				}
+				continue
+			}
+			index = nextIndex(index, meta.LastIndex)
+
+			var update *discovery.KVUpdate
+			switch {
+			case pair != nil && (!exists || pair.ModifyIndex != modifyIndex):
+				exists, modifyIndex = true, pair.ModifyIndex
+				update = &discovery.KVUpdate{Key: key, Value: pair.Value, ModifyIndex: pair.ModifyIndex}
+			case pair == nil && (exists || !loaded):
+				exists, modifyIndex = false, 0
+				update = &discovery.KVUpdate{Key: key, ModifyIndex: meta.LastIndex, Deleted: true}
+			}
+			loaded = true
+			if update == nil {
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case ch <- *update:
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// WatchPrefix sends the changed keys under the prefix on every change using blocking queries
+func (s *Client) WatchPrefix(ctx context.Context, prefix string) (<-chan discovery.KVUpdate, error) {
+	ch := make(chan discovery.KVUpdate, 1)
+	go func() {
+		defer close(ch)
+		var index uint64
+		known := make(map[string]uint64)
+		for {
+			q := (&consulApi.QueryOptions{WaitIndex: index}).WithContext(ctx)
+			pairs, meta, err := s.client.KV().List(prefix, q)
+			if err != nil {
+				if !sleep(ctx, kvRetryTime) {
+					return
+				}
+				continue
+			}
+			index = nextIndex(index, meta.LastIndex)
+
+			var updates []discovery.KVUpdate
+			current := make(map[string]uint64, len(pairs))
+			for _, pair := range pairs {
+				current[pair.Key] = pair.ModifyIndex
+				if old, ok := known[pair.Key]; !ok || old != pair.ModifyIndex {
+					updates = append(updates, discovery.KVUpdate{Key: pair.Key, Value: pair.Value, ModifyIndex: pair.ModifyIndex})
+				}
+			}
+			var deleted []string
+			for k := range known {
+				if _, ok := current[k]; !ok {
+					deleted = append(deleted, k)
+				}
+			}
+			sort.Strings(deleted)
+			for _, k := range deleted {
+				updates = append(updates, discovery.KVUpdate{Key: k, ModifyIndex: meta.LastIndex, Deleted: true})
+			}
+			known = current
+
+			for _, update := range updates {
+				select {
+				case <-ctx.Done():
+					return
+				case ch <- update:
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// nextIndex returns the wait index of the next blocking query, it starts over when the index goes backwards
+func nextIndex(index, lastIndex uint64) uint64 {
+	if lastIndex < index {
+		return 0
+	}
+	return lastIndex
+}
+
+// sleep waits d and reports false when ctx is done first
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
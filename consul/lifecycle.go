@@ -0,0 +1,71 @@
+package consul
+
+import (
+	"context"
+	stdErrors "errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Start registers the service
+func (s *Client) Start() error {
+	if err := s.Register(); err != nil {
+		return errors.Wrap(err, "start error")
+	}
+	return nil
+}
+
+// Shutdown sets the gRPC health status to NOT_SERVING if enabled, waits the drain time,
+// deregisters the service and stops the health self-checks.
+// The service is always deregistered, even when ctx is done before the drain time,
+// the returned error then wraps ctx.Err().
+func (s *Client) Shutdown(ctx context.Context) error {
+	defer s.Close()
+	s.shutdown.Store(true)
+
+	if s.options.ShutdownNotServing && s.healthServer != nil {
+		s.healthServer.SetServingStatus(s.options.Name, grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+	}
+
+	var drainErr error
+	if s.options.DrainTime > 0 {
+		timer := time.NewTimer(time.Duration(s.options.DrainTime) * time.Second)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			drainErr = errors.Wrap(ctx.Err(), "drain error")
+		}
+	}
+
+	if err := s.Deregister(); err != nil {
+		// keep both causes, errors.Is matches the context error and the deregister error
+		return stdErrors.Join(drainErr, errors.Wrap(err, "shutdown error"))
+	}
+	return drainErr
+}
+
+// Run registers the service, blocks until ctx is done or SIGINT/SIGTERM is received, then shuts down
+func (s *Client) Run(ctx context.Context) error {
+	if err := s.Start(); err != nil {
+		return err
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sig)
+
+	select {
+	case <-ctx.Done():
+	case <-sig:
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(s.options.DrainTime+s.options.TimeOut)*time.Second)
+	defer cancel()
+	return s.Shutdown(shutdownCtx)
+}
@@ -0,0 +1,28 @@
+package consul_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+	"github.com/pkg/errors"
+)
+
+func TestShutdownKeepsContextError(t *testing.T) {
+	server := newServer(t)
+	client := newClient(t, server, discovery.WithId("a"), discovery.WithDrainTime(10))
+	if err := client.Register(); err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := client.Shutdown(ctx)
+	if err == nil {
+		t.Fatal("Shutdown against a closed agent succeeded")
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Shutdown = %v, want it to wrap %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,160 @@
+package consul
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+	consulApi "github.com/hashicorp/consul/api"
+	"github.com/pkg/errors"
+)
+
+var (
+	_ discovery.Locker = (*Lock)(nil)
+	_ discovery.Locker = (*Semaphore)(nil)
+)
+
+// tryOnceWaitTime is how long a try once lock waits for the holder to release it
+const tryOnceWaitTime = time.Second
+
+// Lock is a distributed lock on a KV key held by a session
+type Lock struct {
+	key  string
+	lock *consulApi.Lock
+}
+
+// NewLock returns a lock on the key
+func (s *Client) NewLock(key string, opts ...discovery.LockOption) (*Lock, error) {
+	o := discovery.NewLockOptions(opts...)
+	lockOpts := &consulApi.LockOptions{
+		Key:         key,
+		Value:       o.Value,
+		SessionName: fmt.Sprintf("%s lock %s", s.options.Name, key),
+		SessionTTL:  fmt.Sprintf("%ds", o.TTL),
+		LockTryOnce: o.TryOnce,
+	}
+	if o.LockDelay >= 0 {
+		lockOpts.LockDelay = lockDelay(o.LockDelay)
+	}
+	if o.TryOnce {
+		lockOpts.LockWaitTime = tryOnceWaitTime
+	}
+	lock, err := s.client.LockOpts(lockOpts)
+	if err != nil {
+		return nil, errors.Wrapf(err, "create lock error[key=%s]", key)
+	}
+	return &Lock{key: key, lock: lock}, nil
+}
+
+// Lock blocks until the lock is acquired or ctx is done, the returned channel is closed when the lock is lost
+func (l *Lock) Lock(ctx context.Context) (<-chan struct{}, error) {
+
+	stop, cancel := stopChan(ctx)
+	defer cancel()
+	lost, err := l.lock.Lock(stop)
+	if err != nil {
+		return nil, errors.Wrapf(err, "lock error[key=%s]", l.key)
+	}
+	if lost == nil {
+		if err = ctx.Err(); err != nil {
+			return nil, errors.Wrapf(err, "lock error[key=%s]", l.key)
+		}
+		return nil, errors.Wrapf(discovery.ErrLockNotHeld, "lock error[key=%s]", l.key)
+	}
+	return lost, nil
+}
+
+// Unlock releases the lock
+func (l *Lock) Unlock() error {
+	if err := l.lock.Unlock(); err != nil {
+		if err == consulApi.ErrLockNotHeld {
+			return errors.Wrapf(discovery.ErrLockNotHeld, "unlock error[key=%s]", l.key)
+		}
+		return errors.Wrapf(err, "unlock error[key=%s]", l.key)
+	}
+	return nil
+}
+
+// Semaphore is a counting semaphore on a KV prefix, it is held by up to limit holders
+type Semaphore struct {
+	prefix    string
+	semaphore *consulApi.Semaphore
+}
+
+// NewSemaphore returns a semaphore on the prefix held by up to limit holders
+func (s *Client) NewSemaphore(prefix string, limit int, opts ...discovery.LockOption) (*Semaphore, error) {
+	o := discovery.NewLockOptions(opts...)
+	if o.LockDelay >= 0 {
+		// each holder acquires its own contender key, there is no key for a lock delay to guard
+		return nil, errors.Errorf("semaphore does not support lock delay[prefix=%s]", prefix)
+	}
+	semaphoreOpts := &consulApi.SemaphoreOptions{
+		Prefix:           prefix,
+		Limit:            limit,
+		Value:            o.Value,
+		SessionName:      fmt.Sprintf("%s semaphore %s", s.options.Name, prefix),
+		SessionTTL:       fmt.Sprintf("%ds", o.TTL),
+		SemaphoreTryOnce: o.TryOnce,
+	}
+	if o.TryOnce {
+		semaphoreOpts.SemaphoreWaitTime = tryOnceWaitTime
+	}
+	semaphore, err := s.client.SemaphoreOpts(semaphoreOpts)
+	if err != nil {
+		return nil, errors.Wrapf(err, "create semaphore error[prefix=%s]", prefix)
+	}
+	return &Semaphore{prefix: prefix, semaphore: semaphore}, nil
+}
+
+// Lock blocks until a slot is acquired or ctx is done, the returned channel is closed when the slot is lost
+func (m *Semaphore) Lock(ctx context.Context) (<-chan struct{}, error) {
+
+	stop, cancel := stopChan(ctx)
+	defer cancel()
+	lost, err := m.semaphore.Acquire(stop)
+	if err != nil {
+		return nil, errors.Wrapf(err, "acquire semaphore error[prefix=%s]", m.prefix)
+	}
+	if lost == nil {
+		if err = ctx.Err(); err != nil {
+			return nil, errors.Wrapf(err, "acquire semaphore error[prefix=%s]", m.prefix)
+		}
+		return nil, errors.Wrapf(discovery.ErrLockNotHeld, "acquire semaphore error[prefix=%s]", m.prefix)
+	}
+	return lost, nil
+}
+
+// Unlock releases the slot
+func (m *Semaphore) Unlock() error {
+	if err := m.semaphore.Release(); err != nil {
+		if err == consulApi.ErrSemaphoreNotHeld {
+			return errors.Wrapf(discovery.ErrLockNotHeld, "release semaphore error[prefix=%s]", m.prefix)
+		}
+		return errors.Wrapf(err, "release semaphore error[prefix=%s]", m.prefix)
+	}
+	return nil
+}
+
+// lockDelay converts the lock delay in seconds, Consul omits a delay of 0 and applies its default of 15 seconds
+// so 0 is sent as 1ms, the shortest delay it accepts
+func lockDelay(seconds int) time.Duration {
+	if seconds == 0 {
+		return time.Millisecond
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// stopChan returns a channel closed when ctx is done, cancel releases the goroutine
+func stopChan(ctx context.Context) (<-chan struct{}, func()) {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			close(stop)
+		case <-done:
+		}
+	}()
+	return stop, func() { close(done) }
+}
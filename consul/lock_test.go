@@ -0,0 +1,19 @@
+package consul_test
+
+import (
+	"testing"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+)
+
+func TestSemaphoreLockDelay(t *testing.T) {
+	server := newServer(t)
+	client := newClient(t, server)
+
+	if _, err := client.NewSemaphore("sem/", 2, discovery.WithLockDelay(0)); err == nil {
+		t.Fatal("NewSemaphore with a lock delay succeeded")
+	}
+	if _, err := client.NewSemaphore("sem/", 2); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -5,8 +5,11 @@ import (
 	"github.com/donetkit/contrib_discovery/discovery"
 	consulApi "github.com/hashicorp/consul/api"
 	"github.com/pkg/errors"
+	"google.golang.org/grpc/health/grpc_health_v1"
 	"net"
 	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -36,8 +39,16 @@ HTTP
 */
 
 type Client struct {
-	client  *consulApi.Client
-	options *discovery.Config
+	client       *consulApi.Client
+	options      *discovery.Config
+	healthServer *Server
+	exit         chan struct{}
+	closeOnce    sync.Once
+	// shutdown is set once Shutdown starts, the health self-check no longer resets the gRPC health status
+	shutdown atomic.Bool
+
+	heartbeat       chan struct{}
+	heartbeatLocker sync.Mutex
 }
 
 func New(opts ...discovery.Option) (*Client, error) {
@@ -48,7 +59,7 @@ func New(opts ...discovery.Option) (*Client, error) {
 		RegisterPort:   8500,
 		CheckAddr:      GetOutBoundIp(),
 		CheckPort:      80,
-		Tags:           []string{"v0.0.1"},
+		Version:        discovery.DefaultVersion,
 		IntervalTime:   15,
 		DeregisterTime: 15,
 		TimeOut:        3,
@@ -61,6 +72,9 @@ func New(opts ...discovery.Option) (*Client, error) {
 	for _, opt := range opts {
 		opt(cfg)
 	}
+	if cfg.OnUnhealthy == discovery.UnhealthyNotServing && cfg.CheckType != "GRPC" {
+		return nil, errors.Errorf("unhealthy policy NOT_SERVING requires a GRPC check[type=%s]", cfg.CheckType)
+	}
 
 	consulCli, err := consulApi.NewClient(&consulApi.Config{Token: cfg.Token, Address: fmt.Sprintf("%s:%d", cfg.RegisterAddr, cfg.RegisterPort)})
 	if err != nil {
@@ -82,6 +96,12 @@ func New(opts ...discovery.Option) (*Client, error) {
 	consulClient := &Client{
 		options: cfg,
 		client:  consulCli,
+		exit:    make(chan struct{}),
+	}
+	if cfg.CheckType == "GRPC" && cfg.GrpcService != nil {
+		// created once, register runs again on the heartbeat re-registrations
+		consulClient.healthServer = NewServer(cfg.Name, consulClient)
+		grpc_health_v1.RegisterHealthServer(cfg.GrpcService, consulClient.healthServer)
 	}
 
 	consulClient.checkHealthyStatus()
@@ -93,74 +113,93 @@ func (s *Client) SetTags(tags ...string) {
 	s.options.Tags = tags
 }
 
+// Close stops the health self-check goroutines
+func (s *Client) Close() {
+	s.closeOnce.Do(func() {
+		close(s.exit)
+	})
+}
+
 func (s *Client) checkHealthyStatus() {
 	if s.options.CheckHealthyStatus {
 		switch s.options.CheckType {
 		case "HTTP":
-			s.checkHealthyHttp()
+			go s.checkHealthy(nil)
 		case "TCP":
-			s.checkHealthyTCP()
+			go s.checkHealthy(s.probeTCP)
 		case "GRPC":
-			s.checkHealthyGRPC()
+			go s.checkHealthy(nil)
+		case "TTL":
+			go s.checkHealthy(nil)
 		}
 	}
 
 }
 
-func (s *Client) checkHealthyHttp() {
-	go func() {
-		time.Sleep(time.Second * 5)
-		ticker := time.NewTicker(time.Duration(s.options.IntervalTime) * time.Second)
-		for {
-			select {
-			case <-ticker.C:
-				var timeNow = time.Now().Add(time.Duration(s.options.IntervalTime*s.options.CheckResponse.RetryCount) * time.Second * -1).
-					Unix()
-				if timeNow > s.options.CheckResponse.GetOnTime() {
-					ticker.Stop()
-					os.Exit(3)
-				}
+// checkHealthy applies the unhealthy policy once no check has been answered for RetryCount intervals,
+// then keeps checking and applies it again after the checks have recovered and gone stale again
+func (s *Client) checkHealthy(probe func()) {
+	select {
+	case <-s.exit:
+		return
+	case <-time.After(time.Second * 5):
+	}
+	ticker := time.NewTicker(time.Duration(s.options.IntervalTime) * time.Second)
+	defer ticker.Stop()
+	var unhealthy bool
+	for {
+		select {
+		case <-s.exit:
+			return
+		case <-ticker.C:
+			if probe != nil {
+				probe()
 			}
+			var timeNow = time.Now().Add(time.Duration(s.options.IntervalTime*s.options.CheckResponse.RetryCount) * time.Second * -1).Unix()
+			stale := timeNow > s.options.CheckResponse.GetOnTime()
+			if stale && !unhealthy {
+				s.onUnhealthy()
+			} else if !stale && unhealthy {
+				s.onHealthy()
+			}
+			unhealthy = stale
 		}
-	}()
+	}
 }
 
-func (s *Client) checkHealthyTCP() {
-	go func() {
-		time.Sleep(time.Second * 5)
-		ticker := time.NewTicker(time.Duration(s.options.IntervalTime) * time.Second)
-		for {
-			select {
-			case <-ticker.C:
-				conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", s.options.CheckAddr, s.options.CheckPort), 3*time.Second)
-				if err == nil {
-					conn.Close()
-					s.options.CheckResponse.Result()
-				}
-				var timeNow = time.Now().Add(time.Duration(s.options.IntervalTime*s.options.CheckResponse.RetryCount) * time.Second * -1).Unix()
-				if timeNow > s.options.CheckResponse.GetOnTime() {
-					ticker.Stop()
-					os.Exit(3)
-				}
-			}
-		}
-	}()
+func (s *Client) probeTCP() {
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", s.options.CheckAddr, s.options.CheckPort), 3*time.Second)
+	if err == nil {
+		conn.Close()
+		s.options.CheckResponse.Result()
+	}
 }
 
-func (s *Client) checkHealthyGRPC() {
-	go func() {
-		time.Sleep(time.Second * 5)
-		ticker := time.NewTicker(time.Duration(s.options.IntervalTime) * time.Second)
-		for {
-			select {
-			case <-ticker.C:
-				var timeNow = time.Now().Add(time.Duration(s.options.IntervalTime*s.options.CheckResponse.RetryCount) * time.Second * -1).
-					Unix()
-				if timeNow > s.options.CheckResponse.GetOnTime() {
-					ticker.Stop()
-					os.Exit(3)
-				}
-			}
+func (s *Client) onUnhealthy() {
+	switch s.options.OnUnhealthy {
+	case discovery.UnhealthyCallback:
+		if s.options.UnhealthyCallback != nil {
+			s.options.UnhealthyCallback()
+		}
+	case discovery.UnhealthyCancel:
+		if s.options.UnhealthyCancel != nil {
+			s.options.UnhealthyCancel()
+		}
+	case discovery.UnhealthyNotServing:
+		if s.healthServer != nil {
+			s.healthServer.SetServingStatus(s.options.Name, grpc_health_v1.HealthCheckResponse_NOT_SERVING)
 		}
-	}()
+	case discovery.UnhealthyDeregisterExit:
+		_ = s.Deregister()
+		os.Exit(3)
+	default:
+		os.Exit(3)
+	}
+}
+
+// onHealthy undoes the unhealthy policy once the checks are answered again
+func (s *Client) onHealthy() {
+	if s.options.OnUnhealthy == discovery.UnhealthyNotServing && s.healthServer != nil && !s.shutdown.Load() {
+		s.healthServer.SetServingStatus(s.options.Name, grpc_health_v1.HealthCheckResponse_SERVING)
+	}
 }
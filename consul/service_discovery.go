@@ -2,13 +2,26 @@ package consul
 
 import (
 	"fmt"
+	"github.com/donetkit/contrib_discovery/discovery"
 	consulApi "github.com/hashicorp/consul/api"
 	"github.com/pkg/errors"
 	"google.golang.org/grpc/health/grpc_health_v1"
 )
 
 func (s *Client) Register() error {
+	if err := s.register(); err != nil {
+		return err
+	}
+	if s.options.CheckType == "TTL" {
+		s.startHeartbeat()
+	}
+	return nil
+}
+
+// register registers the service and its checks with the agent
+func (s *Client) register() error {
 	check := &consulApi.AgentServiceCheck{
+		CheckID:                        s.serviceCheckId(),
 		Timeout:                        fmt.Sprintf("%ds", s.options.TimeOut),        // 超时时间
 		Interval:                       fmt.Sprintf("%ds", s.options.IntervalTime),   // 健康检查间隔
 		DeregisterCriticalServiceAfter: fmt.Sprintf("%ds", s.options.DeregisterTime), //check失败后多少秒删除本服务，注销时间，相当于过期时间
@@ -22,13 +35,26 @@ func (s *Client) Register() error {
 	case "GRPC":
 		check.GRPC = fmt.Sprintf("%s/%s", s.options.CheckPath, s.options.Name)
 
-		// 2. 注册健康检查服务
-		healthServer := NewServer(s.options.Name, s)
-		grpc_health_v1.RegisterHealthServer(s.options.GrpcService, healthServer)
+		// 健康检查服务在 New 中注册
+		if s.healthServer == nil {
+			return errors.Wrap(errors.Errorf("grpc check without grpc service[id=%s]", s.serviceCheckId()), "register service error")
+		}
 		// 设置服务的健康状态为SERVING（健康）
-		healthServer.SetServingStatus(s.options.Name, grpc_health_v1.HealthCheckResponse_SERVING)
+		s.healthServer.SetServingStatus(s.options.Name, grpc_health_v1.HealthCheckResponse_SERVING)
+	case "TTL":
+		check = &consulApi.AgentServiceCheck{
+			CheckID:                        s.serviceCheckId(),
+			TTL:                            fmt.Sprintf("%ds", s.options.IntervalTime+s.options.TimeOut), // 心跳超时时间
+			DeregisterCriticalServiceAfter: fmt.Sprintf("%ds", s.options.DeregisterTime),
+		}
+	default:
+		return errors.Wrap(errors.Errorf("unknown check type[id=%s,type=%s]", s.serviceCheckId(), s.options.CheckType), "register service error")
 	}
 
+	checks, err := s.checks()
+	if err != nil {
+		return errors.Wrap(err, "register service error")
+	}
 	svcReg := &consulApi.AgentServiceRegistration{
 		ID:                s.options.Id,
 		Name:              s.options.Name,
@@ -36,17 +62,91 @@ func (s *Client) Register() error {
 		Port:              s.options.CheckPort,
 		Address:           s.options.CheckAddr,
 		EnableTagOverride: true,
+		Meta:              s.options.ServiceMetadata(),
 		Check:             check,
-		Checks:            nil,
+		Checks:            checks,
+	}
+	if s.options.WeightPassing > 0 {
+		svcReg.Weights = &consulApi.AgentWeights{Passing: s.options.WeightPassing, Warning: s.options.WeightWarning}
 	}
-	err := s.client.Agent().ServiceRegister(svcReg)
+	err = s.client.Agent().ServiceRegister(svcReg)
 	if err != nil {
 		return errors.Wrap(err, "register service error")
 	}
 	return nil
 }
 
+// serviceCheckId returns the id of the primary health check
+func (s *Client) serviceCheckId() string {
+	return "service:" + s.options.Id
+}
+
+// checks builds the additional health checks of the registration, an unknown check type is an error
+func (s *Client) checks() (consulApi.AgentServiceChecks, error) {
+	if len(s.options.Checks) == 0 {
+		return nil, nil
+	}
+	checks := make(consulApi.AgentServiceChecks, 0, len(s.options.Checks))
+	for i, c := range s.options.Checks {
+		id := c.Id
+		if id == "" {
+			id = fmt.Sprintf("service:%s:%d", s.options.Id, i+1)
+		}
+		interval, timeOut, deregisterTime := c.IntervalTime, c.TimeOut, c.DeregisterTime
+		if interval <= 0 {
+			interval = s.options.IntervalTime
+		}
+		if timeOut <= 0 {
+			timeOut = s.options.TimeOut
+		}
+		if deregisterTime <= 0 {
+			deregisterTime = s.options.DeregisterTime
+		}
+
+		check := &consulApi.AgentServiceCheck{
+			CheckID:                        id,
+			Name:                           c.Name,
+			DeregisterCriticalServiceAfter: fmt.Sprintf("%ds", deregisterTime),
+		}
+		switch c.Type {
+		case "HTTP":
+			check.HTTP = c.Target
+			check.Method = c.Method
+			check.Header = c.Header
+			check.TLSSkipVerify = c.TLSSkipVerify
+		case "TCP":
+			check.TCP = c.Target
+		case "GRPC":
+			check.GRPC = c.Target
+			check.TLSSkipVerify = c.TLSSkipVerify
+		case "TTL":
+			ttl := c.TTL
+			if ttl <= 0 {
+				ttl = interval + timeOut
+			}
+			check.TTL = fmt.Sprintf("%ds", ttl)
+		default:
+			return nil, errors.Errorf("unknown check type[id=%s,type=%s]", id, c.Type)
+		}
+		if c.Type != "TTL" {
+			check.Interval = fmt.Sprintf("%ds", interval)
+			check.Timeout = fmt.Sprintf("%ds", timeOut)
+		}
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
+
+// UpdateCheck reports the status (passing, warning, critical) and output of a TTL check
+func (s *Client) UpdateCheck(checkId, status, output string) error {
+	if err := s.client.Agent().UpdateTTL(checkId, output, status); err != nil {
+		return errors.Wrapf(err, "update check error[key=%s]", checkId)
+	}
+	return nil
+}
+
 func (s *Client) Deregister() error {
+	s.stopHeartbeat()
 	var err error
 	if s.options.Nodes > 1 {
 		catalogServices, _, errService := s.client.Catalog().Service(s.options.Name, "", nil)
@@ -77,3 +177,22 @@ func (s *Client) Deregister() error {
 
 	return err
 }
+
+// instance returns the registered instance of the client
+func (s *Client) instance() *discovery.DefaultServiceInstance {
+	weight := s.options.WeightPassing
+	if weight <= 0 {
+		weight = 1
+	}
+	return &discovery.DefaultServiceInstance{
+		Id:          s.options.Id,
+		ServiceName: s.options.Name,
+		Host:        s.options.CheckAddr,
+		Port:        uint64(s.options.CheckPort),
+		Tags:        s.options.Tags,
+		Enable:      true,
+		Healthy:     true,
+		Weight:      float64(weight),
+		Metadata:    s.options.ServiceMetadata(),
+	}
+}
@@ -0,0 +1,94 @@
+package consul_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestRegisterUnknownPrimaryCheckType(t *testing.T) {
+	server := newServer(t)
+	client := newClient(t, server, discovery.WithId("a"), discovery.WithCheckType("FOO"))
+
+	if err := client.Register(); err == nil {
+		t.Fatal("Register with an unknown check type succeeded")
+	}
+	if _, err := client.GetService(context.Background(), "svc"); !errors.Is(err, discovery.ErrServiceNotFound) {
+		t.Fatalf("GetService = %v, want %v", err, discovery.ErrServiceNotFound)
+	}
+}
+
+func TestRegisterUnknownCheckType(t *testing.T) {
+	server := newServer(t)
+	client := newClient(t, server, discovery.WithId("a"), discovery.WithChecks(discovery.CheckConfig{Type: "UDP", Target: "127.0.0.1:53"}))
+
+	if err := client.Register(); err == nil {
+		t.Fatal("Register with an unknown check type succeeded")
+	}
+	if _, err := client.GetService(context.Background(), "svc"); !errors.Is(err, discovery.ErrServiceNotFound) {
+		t.Fatalf("GetService = %v, want %v", err, discovery.ErrServiceNotFound)
+	}
+}
+
+func TestRegisterGrpcHealth(t *testing.T) {
+	server := newServer(t)
+	if err := newClient(t, server, discovery.WithId("a"), discovery.WithCheckType("GRPC")).Register(); err == nil {
+		t.Fatal("Register with a GRPC check and no gRPC service succeeded")
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gs := grpc.NewServer()
+	client := newClient(t, server, discovery.WithId("b"), discovery.WithCheckGrpc(gs), discovery.WithShutdownNotServing())
+	go func() { _ = gs.Serve(lis) }()
+	t.Cleanup(gs.Stop)
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	health := grpc_health_v1.NewHealthClient(conn)
+	status := func() grpc_health_v1.HealthCheckResponse_ServingStatus {
+		resp, err := health.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{Service: "svc"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.Status
+	}
+
+	if err = client.Register(); err != nil {
+		t.Fatal(err)
+	}
+	if s := status(); s != grpc_health_v1.HealthCheckResponse_SERVING {
+		t.Fatalf("status = %s after Register, want SERVING", s)
+	}
+
+	// the registrations, e.g. of the heartbeat, run along the shutdown
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = client.Register()
+		}()
+	}
+	if err = client.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	if err = client.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if s := status(); s != grpc_health_v1.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("status = %s after Shutdown, want NOT_SERVING", s)
+	}
+}
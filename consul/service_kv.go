@@ -1,48 +1,110 @@
 package consul
 
 import (
+	"context"
+	"github.com/donetkit/contrib_discovery/discovery"
 	consulApi "github.com/hashicorp/consul/api"
 	"github.com/pkg/errors"
 )
 
+var (
+	_ discovery.ContextKV  = (*Client)(nil)
+	_ discovery.PairSetter = (*Client)(nil)
+)
+
 func (s *Client) Get(key string) ([]byte, error) {
-	kv, _, err := s.client.KV().Get(key, nil)
+	return s.GetContext(context.Background(), key)
+}
+
+func (s *Client) Set(key string, value string) error {
+	return s.SetContext(context.Background(), key, value)
+}
+
+func (s *Client) Delete(key string) error {
+	return s.DeleteContext(context.Background(), key)
+}
+
+func (s *Client) List(key string) (map[string][]byte, error) {
+	return s.ListContext(context.Background(), key)
+}
+
+// GetContext returns the value of the key, or an error wrapping discovery.ErrNotFound
+func (s *Client) GetContext(ctx context.Context, key string) ([]byte, error) {
+	pair, err := s.GetPair(ctx, key)
 	if err != nil {
 		return nil, err
 	}
-	if kv == nil {
-		return nil, errors.New("not found value")
-	}
-	return kv.Value, nil
+	return pair.Value, nil
 }
 
-func (s *Client) Set(key string, value string) error {
+func (s *Client) SetContext(ctx context.Context, key string, value string) error {
 	p := &consulApi.KVPair{Key: key, Value: []byte(value)}
-	if _, err := s.client.KV().Put(p, nil); err != nil {
+	if _, err := s.client.KV().Put(p, (&consulApi.WriteOptions{}).WithContext(ctx)); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (s *Client) Delete(key string) error {
-	if _, err := s.client.KV().Delete(key, nil); err != nil {
+func (s *Client) SetPair(ctx context.Context, pair *discovery.KVPair) error {
+	p := &consulApi.KVPair{Key: pair.Key, Value: pair.Value, Flags: pair.Flags}
+	if _, err := s.client.KV().Put(p, (&consulApi.WriteOptions{}).WithContext(ctx)); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (s *Client) List(key string) (map[string][]byte, error) {
-	p, _, err := s.client.KV().List(key, nil)
+func (s *Client) DeleteContext(ctx context.Context, key string) error {
+	if _, err := s.client.KV().Delete(key, (&consulApi.WriteOptions{}).WithContext(ctx)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ListContext returns the values under the prefix, or an error wrapping discovery.ErrNotFound
+func (s *Client) ListContext(ctx context.Context, key string) (map[string][]byte, error) {
+	pairs, err := s.ListPairs(ctx, key)
 	if err != nil {
 		return nil, err
 	}
-	if p == nil {
-		return nil, errors.New("not found value")
-	}
-	values := make(map[string][]byte, len(p))
-	for _, v := range p {
+	values := make(map[string][]byte, len(pairs))
+	for _, v := range pairs {
 		values[v.Key] = v.Value
 	}
 	return values, nil
+}
 
+func (s *Client) GetPair(ctx context.Context, key string) (*discovery.KVPair, error) {
+	kv, _, err := s.client.KV().Get(key, (&consulApi.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if kv == nil {
+		return nil, errors.Wrapf(discovery.ErrNotFound, "get kv error[key=%s]", key)
+	}
+	return newKVPair(kv), nil
+}
+
+func (s *Client) ListPairs(ctx context.Context, prefix string) ([]*discovery.KVPair, error) {
+	p, _, err := s.client.KV().List(prefix, (&consulApi.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if len(p) == 0 {
+		return nil, errors.Wrapf(discovery.ErrNotFound, "list kv error[prefix=%s]", prefix)
+	}
+	pairs := make([]*discovery.KVPair, 0, len(p))
+	for _, v := range p {
+		pairs = append(pairs, newKVPair(v))
+	}
+	return pairs, nil
+}
+
+func newKVPair(p *consulApi.KVPair) *discovery.KVPair {
+	return &discovery.KVPair{
+		Key:         p.Key,
+		Value:       p.Value,
+		ModifyIndex: p.ModifyIndex,
+		Flags:       p.Flags,
+		Session:     p.Session,
+	}
 }
@@ -0,0 +1,52 @@
+package consul
+
+import (
+	"context"
+	"sort"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+	consulApi "github.com/hashicorp/consul/api"
+	"github.com/pkg/errors"
+)
+
+var _ discovery.Resolver = (*Client)(nil)
+
+// GetService returns the instances of a service grouped by version from the health endpoint
+func (s *Client) GetService(ctx context.Context, name string, filters ...discovery.Filter) ([]*discovery.Service, error) {
+	o := discovery.NewFilterOptions(filters...)
+	q := (&consulApi.QueryOptions{}).WithContext(ctx)
+	entries, _, err := s.client.Health().ServiceMultipleTags(name, o.Tags, o.PassingOnly, q)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get service error[name=%s]", name)
+	}
+
+	nodes := make([]discovery.ServiceInstance, 0, len(entries))
+	for _, e := range entries {
+		nodes = append(nodes, newServiceInstance(e))
+	}
+	if len(nodes) == 0 {
+		return nil, errors.Wrapf(discovery.ErrServiceNotFound, "get service error[name=%s]", name)
+	}
+	return discovery.GroupByVersion(name, nodes), nil
+}
+
+// ListServices returns the services of the catalog
+func (s *Client) ListServices(ctx context.Context) ([]*discovery.Service, error) {
+	q := (&consulApi.QueryOptions{}).WithContext(ctx)
+	catalogServices, _, err := s.client.Catalog().Services(q)
+	if err != nil {
+		return nil, errors.Wrap(err, "list services error")
+	}
+
+	names := make([]string, 0, len(catalogServices))
+	for name := range catalogServices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	services := make([]*discovery.Service, 0, len(names))
+	for _, name := range names {
+		services = append(services, &discovery.Service{Name: name})
+	}
+	return services, nil
+}
@@ -0,0 +1,22 @@
+package consul_test
+
+import (
+	"testing"
+
+	"github.com/donetkit/contrib_discovery/consul"
+	"github.com/donetkit/contrib_discovery/discovery"
+)
+
+func TestUnhealthyNotServingCheckType(t *testing.T) {
+	server := newServer(t)
+	opts := append(server.Options(), discovery.WithUnhealthyPolicy(discovery.UnhealthyNotServing))
+
+	if _, err := consul.New(append(opts, discovery.WithCheckType("HTTP"))...); err == nil {
+		t.Fatal("New with NOT_SERVING and a HTTP check succeeded")
+	}
+	client, err := consul.New(append(opts, discovery.WithCheckType("GRPC"))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+}
@@ -1,63 +1,195 @@
 package consul
 
 import (
-	"errors"
+	"context"
+	"fmt"
 	"github.com/donetkit/contrib_discovery/discovery"
 	"github.com/donetkit/contrib_discovery/watcher"
 	"github.com/hashicorp/consul/api"
 	"github.com/hashicorp/consul/api/watch"
+	pkgErrors "github.com/pkg/errors"
+	"strconv"
 	"sync"
+	"time"
 )
 
+var _ watcher.EventWatcher = (*Watcher)(nil)
+
 type Watcher struct {
 	client   *api.Client
+	config   *api.Config
 	option   watcher.WatchOptions
 	wp       *watch.Plan
 	watchers map[string]*watch.Plan
 	exit     chan bool
 	locker   sync.RWMutex
+	wpLocker sync.Mutex
+
+	next       chan *watcher.Event
+	events     chan watcher.Event
+	eventsOnce sync.Once
+	services   map[string][]*discovery.Service
+	// err is the error that stopped the watcher
+	err error
+}
 
-	next     chan *watcher.Result
-	services map[string][]*discovery.Service
+// Watch returns a watcher.Watcher that shares the client's token and address.
+// The watcher is stopped when ctx (or WatchOptions.Context, if set) is done.
+func (s *Client) Watch(ctx context.Context, opts ...watcher.WatchOption) (watcher.EventWatcher, error) {
+	w, err := newWatcher(s.client, &api.Config{
+		Token:   s.options.Token,
+		Address: fmt.Sprintf("%s:%d", s.options.RegisterAddr, s.options.RegisterPort),
+	}, append([]watcher.WatchOption{watcher.WatchContext(ctx)}, opts...)...)
+	if err != nil {
+		// a nil *Watcher would be a non-nil watcher.EventWatcher
+		return nil, err
+	}
+	return w, nil
 }
 
-func newWatcher(client *api.Client, opts ...watcher.WatchOption) (watcher.Watcher, error) {
+// newWatcher runs the watch plans with the client, or with the config when a datacenter is watched:
+// plans run on a client ignore their "datacenter" param
+func newWatcher(client *api.Client, config *api.Config, opts ...watcher.WatchOption) (*Watcher, error) {
 	var wo watcher.WatchOptions
 	for _, o := range opts {
 		o(&wo)
 	}
+	if wo.Context == nil {
+		wo.Context = context.Background()
+	}
 
 	cw := &Watcher{
 		option:   wo,
 		client:   client,
+		config:   config,
 		exit:     make(chan bool),
-		next:     make(chan *watcher.Result, 10),
+		next:     make(chan *watcher.Event, 10),
 		watchers: make(map[string]*watch.Plan),
 		services: make(map[string][]*discovery.Service),
 	}
 
-	wp, err := watch.Parse(map[string]interface{}{"type": "services"})
-	if err != nil {
+	// the service plans are parsed when the services show up, check their params with a placeholder service first
+	if _, err := cw.servicePlan("service"); err != nil {
 		return nil, err
 	}
+	params := map[string]interface{}{"type": "services"}
+	if wo.Datacenter != "" {
+		params["datacenter"] = wo.Datacenter
+	}
+	wp, err := watch.Parse(params)
+	if err != nil {
+		return nil, pkgErrors.Wrap(err, "parse watch error")
+	}
 
 	wp.Handler = cw.handle
-	go wp.RunWithClientAndHclog(client, nil)
 	cw.wp = wp
+	go cw.run(wp)
+
+	go func() {
+		select {
+		case <-wo.Context.Done():
+			cw.Stop()
+		case <-cw.exit:
+		}
+	}()
 
 	return cw, nil
 }
 
+// servicePlan returns the watch plan of the instances of a service
+func (cw *Watcher) servicePlan(service string) (*watch.Plan, error) {
+	params := map[string]interface{}{
+		"type":        "service",
+		"service":     service,
+		"passingonly": cw.option.PassingOnly,
+	}
+	if len(cw.option.Tags) > 0 {
+		params["tag"] = cw.option.Tags
+	}
+	if cw.option.Filter != "" {
+		params["filter"] = cw.option.Filter
+	}
+	if cw.option.Datacenter != "" {
+		params["datacenter"] = cw.option.Datacenter
+	}
+	wp, err := watch.Parse(params)
+	if err != nil {
+		return nil, pkgErrors.Wrapf(err, "parse watch error[service=%s]", service)
+	}
+	return wp, nil
+}
+
+// run runs the plan until it is stopped
+func (cw *Watcher) run(wp *watch.Plan) {
+	if wp.Datacenter == "" {
+		_ = wp.RunWithClientAndHclog(cw.client, nil)
+		return
+	}
+	config := *cw.config
+	_ = wp.RunWithConfig(config.Address, &config)
+}
+
+// send delivers an event unless the watcher has been stopped
+func (cw *Watcher) send(idx uint64, t watcher.EventType, service *discovery.Service) bool {
+	e := &watcher.Event{
+		Id:        strconv.FormatUint(idx, 10),
+		Type:      t,
+		Timestamp: time.Now(),
+		Service:   service,
+	}
+	select {
+	case <-cw.exit:
+		return false
+	case cw.next <- e:
+		return true
+	}
+}
+
+// Next returns the next result, or the error that stopped the watcher
 func (cw *Watcher) Next() (*watcher.Result, error) {
 	select {
 	case <-cw.exit:
-		return nil, errors.New("watcher stopped")
-	case r, ok := <-cw.next:
+		return nil, cw.stopErr()
+	case e, ok := <-cw.next:
 		if !ok {
-			return nil, errors.New("watcher stopped")
+			return nil, cw.stopErr()
 		}
-		return r, nil
+		return &watcher.Result{Action: e.Type.String(), Service: e.Service}, nil
+	}
+}
+
+func (cw *Watcher) stopErr() error {
+	cw.locker.RLock()
+	defer cw.locker.RUnlock()
+	if cw.err != nil {
+		return cw.err
 	}
+	return watcher.ErrStopped
+}
+
+// Events returns the typed events of the watcher, with the Consul index as Id.
+// Events and Next consume the same stream, use one of them.
+// The channel is closed when the watcher is stopped.
+func (cw *Watcher) Events() <-chan watcher.Event {
+	cw.eventsOnce.Do(func() {
+		cw.events = make(chan watcher.Event)
+		go func() {
+			defer close(cw.events)
+			for {
+				select {
+				case <-cw.exit:
+					return
+				case e := <-cw.next:
+					select {
+					case <-cw.exit:
+						return
+					case cw.events <- *e:
+					}
+				}
+			}
+		}()
+	})
+	return cw.events
 }
 
 func (cw *Watcher) Stop() {
@@ -66,10 +198,16 @@ func (cw *Watcher) Stop() {
 		return
 	default:
 		close(cw.exit)
-		if cw.wp == nil {
-			return
+		if cw.wp != nil {
+			cw.wp.Stop()
 		}
-		cw.wp.Stop()
+
+		cw.wpLocker.Lock()
+		for service, wp := range cw.watchers {
+			wp.Stop()
+			delete(cw.watchers, service)
+		}
+		cw.wpLocker.Unlock()
 
 		// drain results
 		for {
@@ -87,6 +225,14 @@ func (cw *Watcher) handle(idx uint64, data interface{}) {
 	if !ok {
 		return
 	}
+	cw.wpLocker.Lock()
+	defer cw.wpLocker.Unlock()
+	select {
+	case <-cw.exit:
+		return
+	default:
+	}
+
 	for service, _ := range services {
 		// Filter on watch options
 		// wo.Service: Only watch services we care about
@@ -94,20 +240,31 @@ func (cw *Watcher) handle(idx uint64, data interface{}) {
 			continue
 		}
 
+		// wo.Tags: services list the tags of all their instances
+		if !discovery.HasTags(services[service], cw.option.Tags) {
+			continue
+		}
+
 		if _, ok := cw.watchers[service]; ok {
 			continue
 		}
-		wp, err := watch.Parse(map[string]interface{}{
-			"type":    "service",
-			"service": service,
-		})
-		if err == nil {
-			wp.Handler = cw.serviceHandler
-
-			go wp.RunWithClientAndHclog(cw.client, nil)
-			cw.watchers[service] = wp
-			cw.next <- &watcher.Result{Action: "create", Service: &discovery.Service{Name: service}}
+		wp, err := cw.servicePlan(service)
+		if err != nil {
+			// Stop waits for this handler to release wpLocker
+			cw.locker.Lock()
+			cw.err = err
+			cw.locker.Unlock()
+			go cw.Stop()
+			return
+		}
+		name := service
+		wp.Handler = func(idx uint64, data interface{}) {
+			cw.serviceHandler(name, idx, data)
 		}
+
+		go cw.run(wp)
+		cw.watchers[service] = wp
+		cw.send(idx, watcher.Create, &discovery.Service{Name: service})
 	}
 	cw.locker.RLock()
 	// make a copy
@@ -138,71 +295,43 @@ func (cw *Watcher) handle(idx uint64, data interface{}) {
 			delete(cw.watchers, service)
 			for _, oldService := range deleted[service] {
 				// send a delete for the service nodes that we're removing
-				cw.next <- &watcher.Result{Action: "delete", Service: oldService}
+				cw.send(idx, watcher.Delete, oldService)
 			}
 			// sent the empty list as the last resort to indicate to delete the entire service
-			cw.next <- &watcher.Result{Action: "delete", Service: &discovery.Service{Name: service}}
+			cw.send(idx, watcher.Delete, &discovery.Service{Name: service})
 		}
 	}
 
 }
 
-func (cw *Watcher) serviceHandler(idx uint64, data interface{}) {
+func (cw *Watcher) serviceHandler(serviceName string, idx uint64, data interface{}) {
 	entries, ok := data.([]*api.ServiceEntry)
 	if !ok {
 		return
 	}
+	// serviceMap is keyed by version
 	serviceMap := map[string]*discovery.Service{}
-	serviceName := ""
 
 	for _, e := range entries {
-
-		serviceName = e.Service.Service
-		// service ID is now the node id
-		id := e.Service.ID
-		key := e.Service.Service
-
-		address := e.Service.Address
-
-		// use node address
-		if len(address) == 0 {
-			address = e.Node.Address
+		node := newServiceInstance(e)
+		// skip the node if the status is critical, or warning when passing only
+		if !node.Healthy || (cw.option.PassingOnly && e.Checks.AggregatedStatus() != api.HealthPassing) {
+			continue
+		}
+		if !cw.option.Match(node) {
+			continue
 		}
 
+		key := discovery.ServiceVersion(e.Service.Meta, e.Service.Tags)
 		svc, ok := serviceMap[key]
 		if !ok {
 			svc = &discovery.Service{
-				Name: e.Service.Service,
+				Name:    serviceName,
+				Version: key,
 			}
 			serviceMap[key] = svc
 		}
-
-		var del bool
-
-		for _, check := range e.Checks {
-			// delete the node if the status is critical
-			if check.Status == "critical" {
-				del = true
-				break
-			}
-		}
-
-		// if delete then skip the node
-		if del {
-			continue
-		}
-
-		svc.Nodes = append(svc.Nodes, &discovery.DefaultServiceInstance{
-			Id:          id,
-			ServiceName: serviceName,
-			Host:        address,
-			Port:        uint64(e.Service.Port),
-			ClusterName: "",
-			Enable:      true,
-			Weight:      10,
-			Healthy:     true,
-			Metadata:    nil,
-		})
+		svc.Nodes = append(svc.Nodes, node)
 	}
 
 	cw.locker.RLock()
@@ -215,7 +344,7 @@ func (cw *Watcher) serviceHandler(idx uint64, data interface{}) {
 
 	var newServices []*discovery.Service
 
-	// serviceMap is the new set of services keyed by name+version
+	// serviceMap is the new set of services keyed by version
 	for _, newService := range serviceMap {
 		// append to the new set of cached services
 		newServices = append(newServices, newService)
@@ -224,12 +353,12 @@ func (cw *Watcher) serviceHandler(idx uint64, data interface{}) {
 		oldServices, ok := discoveryServices[serviceName]
 		if !ok {
 			// does not exist? then we're creating brand new entries
-			cw.next <- &watcher.Result{Action: "create", Service: newService}
+			cw.send(idx, watcher.Create, newService)
 			continue
 		}
 
 		// service exists. ok let's figure out what to update and delete version wise
-		action := "create"
+		action := watcher.Create
 
 		for _, oldService := range oldServices {
 			// does this version exist?
@@ -239,7 +368,7 @@ func (cw *Watcher) serviceHandler(idx uint64, data interface{}) {
 			}
 
 			// yes? then it's an update
-			action = "update"
+			action = watcher.Update
 
 			var nodes []discovery.ServiceInstance
 			// check the old nodes to see if they've been deleted
@@ -262,11 +391,11 @@ func (cw *Watcher) serviceHandler(idx uint64, data interface{}) {
 			if len(nodes) > 0 {
 				delService := CopyService(oldService)
 				delService.Nodes = nodes
-				cw.next <- &watcher.Result{Action: "delete", Service: delService}
+				cw.send(idx, watcher.Delete, delService)
 			}
 		}
 
-		cw.next <- &watcher.Result{Action: action, Service: newService}
+		cw.send(idx, action, newService)
 	}
 
 	// Now check old versions that may not be in new services map
@@ -274,7 +403,7 @@ func (cw *Watcher) serviceHandler(idx uint64, data interface{}) {
 		// old version does not exist in new version map
 		// kill it with fire!
 		if _, ok := serviceMap[old.Version]; !ok {
-			cw.next <- &watcher.Result{Action: "delete", Service: old}
+			cw.send(idx, watcher.Delete, old)
 		}
 	}
 
@@ -283,6 +412,61 @@ func (cw *Watcher) serviceHandler(idx uint64, data interface{}) {
 	cw.locker.Unlock()
 }
 
+// newServiceInstance converts a health entry, the instance is unhealthy if any check is critical
+func newServiceInstance(e *api.ServiceEntry) *discovery.DefaultServiceInstance {
+	address := e.Service.Address
+	// use node address
+	if len(address) == 0 && e.Node != nil {
+		address = e.Node.Address
+	}
+
+	var critical, warning bool
+	for _, check := range e.Checks {
+		if check.Status == "critical" {
+			critical = true
+			break
+		}
+		if check.Status == "warning" {
+			warning = true
+		}
+	}
+
+	weight := e.Service.Weights.Passing
+	if warning {
+		weight = e.Service.Weights.Warning
+	}
+	if weight <= 0 {
+		weight = 1
+	}
+
+	clusterName := e.Service.Datacenter
+	if e.Node != nil && e.Node.Datacenter != "" {
+		clusterName = e.Node.Datacenter
+	}
+
+	var metadata map[string]string
+	if len(e.Service.Meta) > 0 {
+		metadata = make(map[string]string, len(e.Service.Meta))
+		for k, v := range e.Service.Meta {
+			metadata[k] = v
+		}
+	}
+
+	return &discovery.DefaultServiceInstance{
+		// service ID is now the node id
+		Id:          e.Service.ID,
+		ServiceName: e.Service.Service,
+		Host:        address,
+		Port:        uint64(e.Service.Port),
+		Tags:        e.Service.Tags,
+		ClusterName: clusterName,
+		Enable:      true,
+		Weight:      float64(weight),
+		Healthy:     !critical,
+		Metadata:    metadata,
+	}
+}
+
 func CopyService(service *discovery.Service) *discovery.Service {
 	// copy service
 	s := new(discovery.Service)
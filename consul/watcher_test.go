@@ -0,0 +1,26 @@
+package consul_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+	"github.com/donetkit/contrib_discovery/watcher"
+)
+
+func TestWatchDatacenter(t *testing.T) {
+	server := newServer(t)
+	client := newClient(t, server, discovery.WithId("a"))
+
+	w, err := client.Watch(context.Background(), watcher.WatchService("svc"), watcher.WatchDatacenter("dc1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+	if err := client.Register(); err != nil {
+		t.Fatal(err)
+	}
+	if e := nextEvent(t, w.Events()); e.Type != watcher.Create || e.Service.Name != "svc" {
+		t.Fatalf("event = %s %s, want create svc", e.Type, e.Service.Name)
+	}
+}
@@ -0,0 +1,303 @@
+package consultest
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	consulApi "github.com/hashicorp/consul/api"
+)
+
+// SetCheckStatus sets the status (passing, warning, critical) of all checks of a service instance
+func (s *Server) SetCheckStatus(serviceID, status string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	svc, ok := s.services[serviceID]
+	if !ok {
+		return false
+	}
+	for _, check := range svc.checks {
+		check.Status = status
+	}
+	if status == consulApi.HealthCritical {
+		s.invalidateSessionsLocked(svc.checks)
+	}
+	s.touchLocked(svc.reg.Service)
+	return true
+}
+
+func (s *Server) handleServiceRegister(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var reg consulApi.AgentServiceRegistration
+	if err := json.NewDecoder(r.Body).Decode(&reg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if reg.Name == "" {
+		http.Error(w, "Missing service name", http.StatusBadRequest)
+		return
+	}
+	if reg.ID == "" {
+		reg.ID = reg.Name
+	}
+
+	svc := &consulApi.AgentService{
+		ID:                reg.ID,
+		Service:           reg.Name,
+		Tags:              reg.Tags,
+		Port:              reg.Port,
+		Address:           reg.Address,
+		Meta:              reg.Meta,
+		EnableTagOverride: reg.EnableTagOverride,
+		Datacenter:        "dc1",
+	}
+	if reg.Weights != nil {
+		svc.Weights = *reg.Weights
+	} else {
+		svc.Weights = consulApi.AgentWeights{Passing: 1, Warning: 1}
+	}
+
+	var checks consulApi.HealthChecks
+	addCheck := func(i int, c *consulApi.AgentServiceCheck) {
+		if c == nil {
+			return
+		}
+		id := c.CheckID
+		if id == "" {
+			id = "service:" + reg.ID
+			if i > 0 {
+				id = id + ":" + strconv.Itoa(i)
+			}
+		}
+		status := c.Status
+		if status == "" {
+			// checks start passing so that tests see the instance at once
+			status = consulApi.HealthPassing
+		}
+		checks = append(checks, &consulApi.HealthCheck{
+			Node:        NodeName,
+			CheckID:     id,
+			Name:        c.Name,
+			Status:      status,
+			ServiceID:   reg.ID,
+			ServiceName: reg.Name,
+			ServiceTags: reg.Tags,
+		})
+	}
+	addCheck(0, reg.Check)
+	for i, c := range reg.Checks {
+		addCheck(i+1, c)
+	}
+
+	s.mu.Lock()
+	s.services[reg.ID] = &service{reg: svc, checks: checks}
+	s.touchLocked(reg.Name)
+	s.mu.Unlock()
+}
+
+func (s *Server) handleCheckUpdate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/v1/agent/check/update/")
+	var update struct {
+		Status string
+		Output string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, svc := range s.services {
+		for _, check := range svc.checks {
+			if check.CheckID == id {
+				changed := check.Status != update.Status
+				check.Status = update.Status
+				check.Output = update.Output
+				if changed {
+					if check.Status == consulApi.HealthCritical {
+						s.invalidateSessionsLocked(consulApi.HealthChecks{check})
+					}
+					s.touchLocked(svc.reg.Service)
+				}
+				return
+			}
+		}
+	}
+	http.Error(w, "Unknown check ID \""+id+"\"", http.StatusNotFound)
+}
+
+func (s *Server) handleServiceDeregister(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/v1/agent/service/deregister/")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	svc, ok := s.services[id]
+	if !ok {
+		http.Error(w, "Unknown service ID \""+id+"\". Ensure that the service ID is passed, not the service name.", http.StatusNotFound)
+		return
+	}
+	delete(s.services, id)
+	s.invalidateSessionsLocked(svc.checks)
+	s.touchLocked(svc.reg.Service)
+}
+
+func (s *Server) handleCatalogNodes(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	index := s.catalogIndex
+	s.mu.Unlock()
+	setIndex(w, index)
+	writeJSON(w, []*consulApi.Node{{Node: NodeName, Address: s.Host(), Datacenter: "dc1"}})
+}
+
+func (s *Server) handleCatalogServices(w http.ResponseWriter, r *http.Request) {
+	s.block(r, func() uint64 { return s.catalogIndex })
+
+	s.mu.Lock()
+	services := make(map[string][]string)
+	for _, svc := range s.services {
+		tags := services[svc.reg.Service]
+		for _, tag := range svc.reg.Tags {
+			if !contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+		if tags == nil {
+			tags = []string{}
+		}
+		services[svc.reg.Service] = tags
+	}
+	index := s.catalogIndex
+	s.mu.Unlock()
+
+	setIndex(w, index)
+	writeJSON(w, services)
+}
+
+func (s *Server) handleCatalogService(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/v1/catalog/service/")
+	s.block(r, func() uint64 { return s.serviceIndexLocked(name) })
+
+	s.mu.Lock()
+	var result []*consulApi.CatalogService
+	for _, svc := range s.sortedServicesLocked(name, r.URL.Query()["tag"]) {
+		result = append(result, &consulApi.CatalogService{
+			Node:           NodeName,
+			Address:        s.Host(),
+			Datacenter:     "dc1",
+			ServiceID:      svc.reg.ID,
+			ServiceName:    svc.reg.Service,
+			ServiceAddress: svc.reg.Address,
+			ServiceTags:    svc.reg.Tags,
+			ServiceMeta:    svc.reg.Meta,
+			ServicePort:    svc.reg.Port,
+			ServiceWeights: consulApi.Weights{Passing: svc.reg.Weights.Passing, Warning: svc.reg.Weights.Warning},
+		})
+	}
+	index := s.serviceIndexLocked(name)
+	s.mu.Unlock()
+
+	setIndex(w, index)
+	if result == nil {
+		result = []*consulApi.CatalogService{}
+	}
+	writeJSON(w, result)
+}
+
+func (s *Server) handleHealthService(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/v1/health/service/")
+	s.block(r, func() uint64 { return s.serviceIndexLocked(name) })
+
+	query := r.URL.Query()
+	_, passingOnly := query["passing"]
+
+	s.mu.Lock()
+	var result []*consulApi.ServiceEntry
+	for _, svc := range s.sortedServicesLocked(name, query["tag"]) {
+		if passingOnly && svc.checks.AggregatedStatus() != consulApi.HealthPassing {
+			continue
+		}
+		reg := *svc.reg
+		checks := make(consulApi.HealthChecks, 0, len(svc.checks))
+		for _, check := range svc.checks {
+			c := *check
+			checks = append(checks, &c)
+		}
+		result = append(result, &consulApi.ServiceEntry{
+			Node:    &consulApi.Node{Node: NodeName, Address: s.Host(), Datacenter: "dc1"},
+			Service: &reg,
+			Checks:  checks,
+		})
+	}
+	index := s.serviceIndexLocked(name)
+	s.mu.Unlock()
+
+	setIndex(w, index)
+	if result == nil {
+		result = []*consulApi.ServiceEntry{}
+	}
+	writeJSON(w, result)
+}
+
+// touchLocked bumps the catalog and service indexes and wakes blocking queries, s.mu must be held
+func (s *Server) touchLocked(name string) {
+	s.catalogIndex++
+	s.serviceIndex[name] = s.catalogIndex
+	s.notifyLocked()
+}
+
+// serviceIndexLocked returns the index of the last change of a service, s.mu must be held
+func (s *Server) serviceIndexLocked(name string) uint64 {
+	if index, ok := s.serviceIndex[name]; ok {
+		return index
+	}
+	return s.catalogIndex
+}
+
+func (s *Server) sortedServicesLocked(name string, tags []string) []*service {
+	var services []*service
+	for _, svc := range s.services {
+		if svc.reg.Service != name {
+			continue
+		}
+		var missing bool
+		for _, tag := range tags {
+			if !contains(svc.reg.Tags, tag) {
+				missing = true
+				break
+			}
+		}
+		if !missing {
+			services = append(services, svc)
+		}
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].reg.ID < services[j].reg.ID })
+	return services
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
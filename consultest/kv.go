@@ -0,0 +1,152 @@
+package consultest
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	consulApi "github.com/hashicorp/consul/api"
+)
+
+func (s *Server) handleKV(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+	switch r.Method {
+	case http.MethodGet:
+		s.kvGet(w, r, key)
+	case http.MethodPut:
+		s.kvPut(w, r, key)
+	case http.MethodDelete:
+		s.kvDelete(w, r, key)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) kvGet(w http.ResponseWriter, r *http.Request, key string) {
+	query := r.URL.Query()
+	_, recurse := query["recurse"]
+	_, keys := query["keys"]
+	s.block(r, func() uint64 { return s.kvIndex })
+
+	s.mu.Lock()
+	pairs := s.kvPairsLocked(key, recurse || keys)
+	index := s.kvIndex
+	s.mu.Unlock()
+
+	setIndex(w, index)
+	if len(pairs) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if keys {
+		names := make([]string, 0, len(pairs))
+		for _, p := range pairs {
+			names = append(names, p.Key)
+		}
+		writeJSON(w, names)
+		return
+	}
+	writeJSON(w, pairs)
+}
+
+func (s *Server) kvPut(w http.ResponseWriter, r *http.Request, key string) {
+	value, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query := r.URL.Query()
+	flags, _ := strconv.ParseUint(query.Get("flags"), 10, 64)
+	acquire, release := query.Get("acquire"), query.Get("release")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pair, ok := s.kv[key]
+	if !s.casLocked(query, pair) {
+		writeJSON(w, false)
+		return
+	}
+	if acquire != "" {
+		if _, valid := s.sessions[acquire]; !valid {
+			http.Error(w, "invalid session \""+acquire+"\"", http.StatusInternalServerError)
+			return
+		}
+		if ok && pair.Session != "" && pair.Session != acquire {
+			writeJSON(w, false)
+			return
+		}
+	}
+	if release != "" && (!ok || pair.Session != release) {
+		writeJSON(w, false)
+		return
+	}
+
+	s.kvIndex++
+	if !ok {
+		pair = &consulApi.KVPair{Key: key, CreateIndex: s.kvIndex}
+		s.kv[key] = pair
+	}
+	pair.Value = value
+	pair.Flags = flags
+	pair.ModifyIndex = s.kvIndex
+	if acquire != "" && pair.Session != acquire {
+		pair.Session = acquire
+		pair.LockIndex++
+	}
+	if release != "" {
+		pair.Session = ""
+	}
+	s.notifyLocked()
+	writeJSON(w, true)
+}
+
+// casLocked checks the ?cas= index of a write, 0 means the key must not exist, s.mu must be held
+func (s *Server) casLocked(query url.Values, pair *consulApi.KVPair) bool {
+	if _, ok := query["cas"]; !ok {
+		return true
+	}
+	cas, err := strconv.ParseUint(query.Get("cas"), 10, 64)
+	if err != nil {
+		return false
+	}
+	if cas == 0 {
+		return pair == nil
+	}
+	return pair != nil && pair.ModifyIndex == cas
+}
+
+func (s *Server) kvDelete(w http.ResponseWriter, r *http.Request, key string) {
+	query := r.URL.Query()
+	_, recurse := query["recurse"]
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// a delete-cas of a missing key succeeds
+	if pair, ok := s.kv[key]; !recurse && ok && !s.casLocked(query, pair) {
+		writeJSON(w, false)
+		return
+	}
+	for _, p := range s.kvPairsLocked(key, recurse) {
+		delete(s.kv, p.Key)
+	}
+	s.kvIndex++
+	s.notifyLocked()
+	writeJSON(w, true)
+}
+
+// kvPairsLocked returns copies of the pairs matching key or prefix sorted by key, s.mu must be held
+func (s *Server) kvPairsLocked(key string, prefix bool) consulApi.KVPairs {
+	var pairs consulApi.KVPairs
+	for k, p := range s.kv {
+		if k == key || (prefix && strings.HasPrefix(k, key)) {
+			c := *p
+			c.Value = append([]byte(nil), p.Value...)
+			pairs = append(pairs, &c)
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].Key < pairs[j].Key })
+	return pairs
+}
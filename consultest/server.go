@@ -0,0 +1,144 @@
+package consultest
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+	consulApi "github.com/hashicorp/consul/api"
+)
+
+// NodeName is the name of the single node of the fake agent
+const NodeName = "consultest"
+
+// maxWait is the longest a blocking query waits, as the Consul agent does
+const maxWait = 10 * time.Minute
+
+// Server is a fake Consul agent speaking the subset of the HTTP API used by this library:
+// agent service register/deregister, catalog nodes/services, health service, KV, transactions and sessions,
+// including blocking queries.
+type Server struct {
+	*httptest.Server
+
+	mu sync.Mutex
+	// changed is closed and replaced on every write to wake blocking queries
+	changed      chan struct{}
+	catalogIndex uint64
+	kvIndex      uint64
+	services     map[string]*service
+	serviceIndex map[string]uint64
+	kv           map[string]*consulApi.KVPair
+	sessionIndex uint64
+	sessions     map[string]*consulApi.SessionEntry
+}
+
+type service struct {
+	reg    *consulApi.AgentService
+	checks consulApi.HealthChecks
+}
+
+// NewServer starts a fake Consul agent, it must be closed with Close
+func NewServer() *Server {
+	s := &Server{
+		changed:      make(chan struct{}),
+		catalogIndex: 1,
+		kvIndex:      1,
+		services:     make(map[string]*service),
+		serviceIndex: make(map[string]uint64),
+		kv:           make(map[string]*consulApi.KVPair),
+		sessionIndex: 1,
+		sessions:     make(map[string]*consulApi.SessionEntry),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/agent/service/register", s.handleServiceRegister)
+	mux.HandleFunc("/v1/agent/service/deregister/", s.handleServiceDeregister)
+	mux.HandleFunc("/v1/agent/check/update/", s.handleCheckUpdate)
+	mux.HandleFunc("/v1/catalog/nodes", s.handleCatalogNodes)
+	mux.HandleFunc("/v1/catalog/services", s.handleCatalogServices)
+	mux.HandleFunc("/v1/catalog/service/", s.handleCatalogService)
+	mux.HandleFunc("/v1/health/service/", s.handleHealthService)
+	mux.HandleFunc("/v1/kv/", s.handleKV)
+	mux.HandleFunc("/v1/txn", s.handleTxn)
+	mux.HandleFunc("/v1/session/create", s.handleSessionCreate)
+	mux.HandleFunc("/v1/session/destroy/", s.handleSessionDestroy)
+	mux.HandleFunc("/v1/session/renew/", s.handleSessionRenew)
+	mux.HandleFunc("/v1/session/info/", s.handleSessionInfo)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// Host returns the host of the fake agent
+func (s *Server) Host() string {
+	host, _, _ := net.SplitHostPort(s.Listener.Addr().String())
+	return host
+}
+
+// Port returns the port of the fake agent
+func (s *Server) Port() int {
+	_, port, _ := net.SplitHostPort(s.Listener.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return p
+}
+
+// Options returns the options pointing a consul.Client to the fake agent
+func (s *Server) Options() []discovery.Option {
+	return []discovery.Option{
+		discovery.WithRegisterAddr(s.Host()),
+		discovery.WithRegisterPort(s.Port()),
+	}
+}
+
+// notifyLocked wakes blocking queries, s.mu must be held
+func (s *Server) notifyLocked() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// block waits until index() moves past the ?index= of the request or ?wait= expires
+func (s *Server) block(r *http.Request, index func() uint64) {
+	query := r.URL.Query()
+	minIndex, _ := strconv.ParseUint(query.Get("index"), 10, 64)
+	if minIndex == 0 {
+		return
+	}
+	wait := 5 * time.Minute
+	if v := query.Get("wait"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			wait = d
+		}
+	}
+	if wait > maxWait {
+		wait = maxWait
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		s.mu.Lock()
+		if index() > minIndex {
+			s.mu.Unlock()
+			return
+		}
+		changed := s.changed
+		s.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-timer.C:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func setIndex(w http.ResponseWriter, index uint64) {
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(index, 10))
+	w.Header().Set("X-Consul-KnownLeader", "true")
+	w.Header().Set("X-Consul-LastContact", "0")
+}
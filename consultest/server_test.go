@@ -0,0 +1,205 @@
+package consultest_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/donetkit/contrib_discovery/consul"
+	"github.com/donetkit/contrib_discovery/consultest"
+	"github.com/donetkit/contrib_discovery/discovery"
+	"github.com/donetkit/contrib_discovery/watcher"
+	"github.com/pkg/errors"
+)
+
+func newClient(t *testing.T, server *consultest.Server, opts ...discovery.Option) *consul.Client {
+	t.Helper()
+	opts = append(append([]discovery.Option{
+		discovery.WithName("svc"),
+		discovery.WithCheckAddr("127.0.0.1"),
+		discovery.WithCheckPort(8080),
+	}, server.Options()...), opts...)
+	client, err := consul.New(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+	return client
+}
+
+func nextEvent(t *testing.T, events <-chan watcher.Event) watcher.Event {
+	t.Helper()
+	select {
+	case e, ok := <-events:
+		if !ok {
+			t.Fatal("events closed")
+		}
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event")
+	}
+	return watcher.Event{}
+}
+
+func TestRegisterWatch(t *testing.T) {
+	server := consultest.NewServer()
+	defer server.Close()
+	client := newClient(t, server, discovery.WithId("a"), discovery.WithVersion("1.0.0"))
+
+	w, err := client.Watch(context.Background(), watcher.WatchService("svc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+	events := w.Events()
+
+	if err := client.Register(); err != nil {
+		t.Fatal(err)
+	}
+	if e := nextEvent(t, events); e.Type != watcher.Create || e.Service.Name != "svc" || e.Service.Version != "" {
+		t.Fatalf("event = %s %s@%s, want create svc", e.Type, e.Service.Name, e.Service.Version)
+	}
+	e := nextEvent(t, events)
+	if e.Type != watcher.Create || e.Service.Version != "1.0.0" || len(e.Service.Nodes) != 1 {
+		t.Fatalf("event = %s %s@%s with %d nodes, want create svc@1.0.0 with 1 node", e.Type, e.Service.Name, e.Service.Version, len(e.Service.Nodes))
+	}
+	if node := e.Service.Nodes[0]; node.GetId() != "a" || node.GetHost() != "127.0.0.1" || node.GetPort() != 8080 {
+		t.Fatalf("node = %s %s:%d, want a 127.0.0.1:8080", node.GetId(), node.GetHost(), node.GetPort())
+	}
+
+	services, err := client.GetService(context.Background(), "svc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 1 || services[0].Version != "1.0.0" || len(services[0].Nodes) != 1 {
+		t.Fatalf("GetService = %+v", services)
+	}
+
+	if err := client.Deregister(); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		e := nextEvent(t, events)
+		if e.Type != watcher.Delete {
+			t.Fatalf("event = %s, want delete", e.Type)
+		}
+		if e.Service.Version == "" {
+			break
+		}
+	}
+	if _, err := client.GetService(context.Background(), "svc"); !errors.Is(err, discovery.ErrServiceNotFound) {
+		t.Fatalf("GetService after Deregister = %v, want %v", err, discovery.ErrServiceNotFound)
+	}
+}
+
+func TestKV(t *testing.T) {
+	server := consultest.NewServer()
+	defer server.Close()
+	client := newClient(t, server)
+	ctx := context.Background()
+
+	if _, err := client.Get("app/a"); !errors.Is(err, discovery.ErrNotFound) {
+		t.Fatalf("Get missing = %v, want %v", err, discovery.ErrNotFound)
+	}
+	if err := client.Set("app/a", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Set("app/b", "2"); err != nil {
+		t.Fatal(err)
+	}
+	value, err := client.Get("app/a")
+	if err != nil || string(value) != "1" {
+		t.Fatalf("Get = %q, %v, want 1", value, err)
+	}
+	values, err := client.List("app/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 2 || string(values["app/b"]) != "2" {
+		t.Fatalf("List = %v", values)
+	}
+
+	pair, err := client.GetPair(ctx, "app/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CompareAndSet(ctx, "app/a", "3", pair.ModifyIndex+100); !errors.Is(err, discovery.ErrConflict) {
+		t.Fatalf("CompareAndSet stale = %v, want %v", err, discovery.ErrConflict)
+	}
+	if err := client.CompareAndSet(ctx, "app/a", "3", pair.ModifyIndex); err != nil {
+		t.Fatal(err)
+	}
+
+	pairs, err := client.Txn(ctx, discovery.NewTxn().Set("app/c", "4").Get("app/a").Delete("app/b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pairs) != 1 || pairs[0].Key != "app/a" || string(pairs[0].Value) != "3" {
+		t.Fatalf("Txn pairs = %+v", pairs)
+	}
+	if _, err := client.Txn(ctx, discovery.NewTxn().Set("app/d", "5").CheckIndex("app/a", 1)); !errors.Is(err, discovery.ErrTxnAborted) {
+		t.Fatalf("Txn with a stale index = %v, want %v", err, discovery.ErrTxnAborted)
+	}
+	if _, err := client.Get("app/d"); !errors.Is(err, discovery.ErrNotFound) {
+		t.Fatalf("aborted Txn wrote app/d: %v", err)
+	}
+
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	updates, err := client.WatchKey(wctx, "app/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := func() discovery.KVUpdate {
+		t.Helper()
+		select {
+		case u := <-updates:
+			return u
+		case <-time.After(5 * time.Second):
+			t.Fatal("no update")
+		}
+		return discovery.KVUpdate{}
+	}
+	if u := next(); u.Key != "app/b" || !u.Deleted {
+		t.Fatalf("first update = %+v, want a deleted app/b", u)
+	}
+	if err := client.Set("app/b", "6"); err != nil {
+		t.Fatal(err)
+	}
+	if u := next(); u.Deleted || string(u.Value) != "6" {
+		t.Fatalf("update = %+v, want app/b=6", u)
+	}
+}
+
+func TestLock(t *testing.T) {
+	server := consultest.NewServer()
+	defer server.Close()
+	client := newClient(t, server)
+	ctx := context.Background()
+
+	lock, err := client.NewLock("locks/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lock.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := client.NewLock("locks/a", discovery.WithLockTryOnce())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Lock(ctx); !errors.Is(err, discovery.ErrLockNotHeld) {
+		t.Fatalf("Lock of a held lock = %v, want %v", err, discovery.ErrLockNotHeld)
+	}
+
+	if err := lock.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,152 @@
+package consultest
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	consulApi "github.com/hashicorp/consul/api"
+)
+
+// Sessions never expire in the fake agent, they end on destroy.
+
+func (s *Server) handleSessionCreate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var entry consulApi.SessionEntry
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	entry.ID = newID()
+	entry.Node = NodeName
+	if entry.Behavior == "" {
+		entry.Behavior = consulApi.SessionBehaviorRelease
+	}
+
+	s.mu.Lock()
+	s.sessionIndex++
+	entry.CreateIndex = s.sessionIndex
+	s.sessions[entry.ID] = &entry
+	s.mu.Unlock()
+
+	writeJSON(w, map[string]string{"ID": entry.ID})
+}
+
+func (s *Server) handleSessionDestroy(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/v1/session/destroy/")
+
+	s.mu.Lock()
+	s.destroySessionLocked(id)
+	s.mu.Unlock()
+	writeJSON(w, true)
+}
+
+func (s *Server) handleSessionRenew(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/v1/session/renew/")
+
+	s.mu.Lock()
+	entry, ok := s.sessions[id]
+	var c consulApi.SessionEntry
+	if ok {
+		c = *entry
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		http.Error(w, "Session id '"+id+"' not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, []*consulApi.SessionEntry{&c})
+}
+
+func (s *Server) handleSessionInfo(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/v1/session/info/")
+
+	s.mu.Lock()
+	entry, ok := s.sessions[id]
+	result := []*consulApi.SessionEntry{}
+	if ok {
+		c := *entry
+		result = append(result, &c)
+	}
+	index := s.sessionIndex
+	s.mu.Unlock()
+
+	setIndex(w, index)
+	writeJSON(w, result)
+}
+
+// destroySessionLocked ends a session and releases or deletes its keys, s.mu must be held
+func (s *Server) destroySessionLocked(id string) {
+	entry, ok := s.sessions[id]
+	if !ok {
+		return
+	}
+	delete(s.sessions, id)
+	s.sessionIndex++
+
+	var changed bool
+	for key, pair := range s.kv {
+		if pair.Session != id {
+			continue
+		}
+		changed = true
+		s.kvIndex++
+		if entry.Behavior == consulApi.SessionBehaviorDelete {
+			delete(s.kv, key)
+			continue
+		}
+		pair.Session = ""
+		pair.ModifyIndex = s.kvIndex
+	}
+	if changed {
+		s.notifyLocked()
+	}
+}
+
+// invalidateSessionsLocked destroys the sessions bound to the checks, s.mu must be held
+func (s *Server) invalidateSessionsLocked(checks consulApi.HealthChecks) {
+	for id, entry := range s.sessions {
+		for _, check := range checks {
+			if boundTo(entry, check.CheckID) {
+				s.destroySessionLocked(id)
+				break
+			}
+		}
+	}
+}
+
+func boundTo(entry *consulApi.SessionEntry, checkID string) bool {
+	for _, c := range entry.Checks {
+		if c == checkID {
+			return true
+		}
+	}
+	for _, c := range entry.ServiceChecks {
+		if c.ID == checkID {
+			return true
+		}
+	}
+	return false
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
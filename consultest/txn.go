@@ -0,0 +1,125 @@
+package consultest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	consulApi "github.com/hashicorp/consul/api"
+)
+
+// handleTxn applies the KV operations of a transaction in order on a staged copy of the keys,
+// the writes are committed with a single index if every operation succeeds
+func (s *Server) handleTxn(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var ops consulApi.TxnOps
+	if err := json.NewDecoder(r.Body).Decode(&ops); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := s.kvIndex + 1
+	// staged holds the written keys, nil for deleted keys
+	staged := make(map[string]*consulApi.KVPair)
+	lookup := func(key string) *consulApi.KVPair {
+		if pair, ok := staged[key]; ok {
+			return pair
+		}
+		return s.kv[key]
+	}
+	set := func(op *consulApi.KVTxnOp, pair *consulApi.KVPair) *consulApi.KVPair {
+		n := &consulApi.KVPair{Key: op.Key, CreateIndex: index}
+		if pair != nil {
+			*n = *pair
+		}
+		n.Value = append([]byte(nil), op.Value...)
+		n.Flags = op.Flags
+		n.ModifyIndex = index
+		staged[op.Key] = n
+		return n
+	}
+
+	var errs consulApi.TxnErrors
+	var results consulApi.TxnResults
+	for i, op := range ops {
+		if op.KV == nil {
+			errs = append(errs, &consulApi.TxnError{OpIndex: i, What: "only KV operations are supported"})
+			continue
+		}
+		pair := lookup(op.KV.Key)
+		var result *consulApi.KVPair
+		var what string
+		switch op.KV.Verb {
+		case consulApi.KVSet:
+			result = set(op.KV, pair)
+		case consulApi.KVCAS:
+			if (op.KV.Index == 0 && pair != nil) || (op.KV.Index != 0 && (pair == nil || pair.ModifyIndex != op.KV.Index)) {
+				what = fmt.Sprintf("failed to set key %q, index is stale", op.KV.Key)
+				break
+			}
+			result = set(op.KV, pair)
+		case consulApi.KVDelete:
+			staged[op.KV.Key] = nil
+		case consulApi.KVDeleteCAS:
+			if pair != nil && pair.ModifyIndex != op.KV.Index {
+				what = fmt.Sprintf("failed to delete key %q, index is stale", op.KV.Key)
+				break
+			}
+			staged[op.KV.Key] = nil
+		case consulApi.KVGet:
+			if pair == nil {
+				what = fmt.Sprintf("key %q doesn't exist", op.KV.Key)
+				break
+			}
+			result = pair
+		case consulApi.KVCheckIndex:
+			if pair == nil {
+				what = fmt.Sprintf("key %q doesn't exist", op.KV.Key)
+			} else if pair.ModifyIndex != op.KV.Index {
+				what = fmt.Sprintf("current modify index %d != %d", pair.ModifyIndex, op.KV.Index)
+			} else {
+				result = pair
+			}
+		default:
+			what = fmt.Sprintf("unknown KV verb %q", op.KV.Verb)
+		}
+		if what != "" {
+			errs = append(errs, &consulApi.TxnError{OpIndex: i, What: what})
+			continue
+		}
+		// deletes have no result, only gets return the value
+		if result != nil {
+			c := *result
+			c.Value = nil
+			if op.KV.Verb == consulApi.KVGet {
+				c.Value = append([]byte(nil), result.Value...)
+			}
+			results = append(results, &consulApi.TxnResult{KV: &c})
+		}
+	}
+	if len(errs) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		_ = json.NewEncoder(w).Encode(&consulApi.TxnResponse{Errors: errs})
+		return
+	}
+
+	if len(staged) > 0 {
+		s.kvIndex = index
+		for key, pair := range staged {
+			if pair == nil {
+				delete(s.kv, key)
+			} else {
+				s.kv[key] = pair
+			}
+		}
+		s.notifyLocked()
+	}
+	writeJSON(w, &consulApi.TxnResponse{Results: results})
+}
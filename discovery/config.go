@@ -1,9 +1,28 @@
 package discovery
 
 import (
+	"context"
+
 	"google.golang.org/grpc"
 )
 
+// UnhealthyPolicy is applied each time the health self-check goes stale
+type UnhealthyPolicy int
+
+const (
+	// UnhealthyExit exits the process with code 3
+	UnhealthyExit UnhealthyPolicy = iota
+	// UnhealthyCallback calls Config.UnhealthyCallback
+	UnhealthyCallback
+	// UnhealthyCancel calls Config.UnhealthyCancel
+	UnhealthyCancel
+	// UnhealthyNotServing sets the gRPC health status to NOT_SERVING, and back to SERVING once the checks recover.
+	// It requires the GRPC check type.
+	UnhealthyNotServing
+	// UnhealthyDeregisterExit deregisters the service and exits the process with code 3
+	UnhealthyDeregisterExit
+)
+
 type Config struct {
 	Id                 string
 	Name               string
@@ -19,9 +38,50 @@ type Config struct {
 	HttpRouter         HttpRouter
 	CheckHealthyStatus bool
 	CheckResponse      *CheckResponse
-	CheckType          string // 检查类型 HTTP TCP GRPC
+	CheckType          string // 检查类型 HTTP TCP GRPC TTL
 	CheckPath          string
 	Token              string
 	GrpcService        grpc.ServiceRegistrar
 	Nodes              int
+	OnUnhealthy        UnhealthyPolicy // 健康检查失败后的处理策略
+	UnhealthyCallback  func()
+	UnhealthyCancel    context.CancelFunc
+	OnHeartbeatError   func(err error)   // TTL心跳上报失败的回调
+	DrainTime          int               // 注销前等待时间，单位秒
+	ShutdownNotServing bool              // 注销前设置gRPC健康状态为NOT_SERVING
+	Checks             []CheckConfig     // 附加健康检查
+	Version            string            // 服务版本，注册到 Metadata[MetadataVersionKey]，默认 DefaultVersion
+	Metadata           map[string]string // 服务元数据
+	WeightPassing      int               // 健康时的权重
+	WeightWarning      int               // 警告时的权重
+}
+
+// ServiceMetadata returns the metadata to register, including the version
+func (cfg *Config) ServiceMetadata() map[string]string {
+	if len(cfg.Metadata) == 0 && cfg.Version == "" {
+		return nil
+	}
+	metadata := make(map[string]string, len(cfg.Metadata)+1)
+	for k, v := range cfg.Metadata {
+		metadata[k] = v
+	}
+	if cfg.Version != "" {
+		metadata[MetadataVersionKey] = cfg.Version
+	}
+	return metadata
+}
+
+// CheckConfig is an additional health check attached to the registration
+type CheckConfig struct {
+	Id             string              // 默认 service:[Id]:[序号]
+	Name           string              // 检查名称
+	Type           string              // 检查类型 HTTP TCP GRPC TTL
+	Target         string              // HTTP: url, TCP: addr:port, GRPC: addr:port/service
+	Method         string              // HTTP 请求方法
+	Header         map[string][]string // HTTP 请求头
+	TLSSkipVerify  bool                // HTTP GRPC 跳过证书校验
+	IntervalTime   int                 // 健康检查间隔，默认Config.IntervalTime
+	TimeOut        int                 // 超时时间，默认Config.TimeOut
+	DeregisterTime int                 // check失败后删除本服务的时间，默认Config.DeregisterTime
+	TTL            int                 // TTL 超时时间，由 Client.UpdateCheck 上报
 }
@@ -0,0 +1,16 @@
+package discovery
+
+import "context"
+
+// LeaderElector elects one leader among the instances of a service
+type LeaderElector interface {
+	// Campaign blocks until the instance is elected or ctx is done
+	Campaign(ctx context.Context) error
+	// Resign gives up the leadership
+	Resign() error
+	// IsLeader reports whether the instance is the leader
+	IsLeader() bool
+	// Observe returns the current leader on every change, nil when there is no leader.
+	// The channel is closed when ctx is done.
+	Observe(ctx context.Context) <-chan ServiceInstance
+}
@@ -1,8 +1,62 @@
 package discovery
 
+import (
+	"context"
+	"errors"
+)
+
+// ErrNotFound is returned when a key or prefix does not exist, test it with errors.Is
+var ErrNotFound = errors.New("not found value")
+
 type KV interface {
 	Get(key string) ([]byte, error)
 	Set(key string, value string) error
 	Delete(key string) error
 	List(key string) (map[string][]byte, error)
 }
+
+// KVPair is a key with its value and metadata
+type KVPair struct {
+	Key         string
+	Value       []byte
+	ModifyIndex uint64
+	Flags       uint64
+	// Session holding the lock on the key, if any
+	Session string
+}
+
+// ContextKV is a KV whose calls can be cancelled, and that returns the metadata of the keys
+type ContextKV interface {
+	KV
+	GetContext(ctx context.Context, key string) ([]byte, error)
+	SetContext(ctx context.Context, key string, value string) error
+	DeleteContext(ctx context.Context, key string) error
+	ListContext(ctx context.Context, key string) (map[string][]byte, error)
+	// GetPair returns the key with its metadata
+	GetPair(ctx context.Context, key string) (*KVPair, error)
+	// ListPairs returns the keys under the prefix with their metadata, sorted by key
+	ListPairs(ctx context.Context, prefix string) ([]*KVPair, error)
+}
+
+// PairSetter is a ContextKV storing flags with the keys
+type PairSetter interface {
+	// SetPair writes the value and flags of the key
+	SetPair(ctx context.Context, pair *KVPair) error
+}
+
+// KVUpdate is a change of a key
+type KVUpdate struct {
+	Key         string
+	Value       []byte
+	ModifyIndex uint64
+	// Deleted is set when the key was removed
+	Deleted bool
+}
+
+// KVWatcher notifies the changes of keys, the current values are sent first.
+// WatchKey sends a Deleted update first when the key does not exist, so absent keys can be told from pending loads.
+// The channels are closed when ctx is done.
+type KVWatcher interface {
+	WatchKey(ctx context.Context, key string) (<-chan KVUpdate, error)
+	WatchPrefix(ctx context.Context, prefix string) (<-chan KVUpdate, error)
+}
@@ -0,0 +1,75 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrLockNotHeld is returned by Unlock when the lock is not held, and by Lock when TryOnce fails
+var ErrLockNotHeld = errors.New("lock not held")
+
+// Locker is a distributed lock, a semaphore with a limit of n is a Locker held by up to n holders
+type Locker interface {
+	// Lock blocks until the lock is acquired or ctx is done.
+	// The returned channel is closed when the lock is lost, e.g. the session expired.
+	Lock(ctx context.Context) (<-chan struct{}, error)
+	// Unlock releases the lock
+	Unlock() error
+}
+
+// LockOptions for lockers
+type LockOptions struct {
+	// TTL of the session holding the lock in seconds, the lock is lost when the holder stops renewing it
+	TTL int
+	// LockDelay in seconds during which a lost lock cannot be acquired again, 0 disables it.
+	// It defaults to the delay of the backend, 15 seconds for Consul. Semaphores do not support it.
+	LockDelay int
+	// Value stored with the lock
+	Value []byte
+	// TryOnce makes Lock return at once when the lock is held by another holder
+	TryOnce bool
+}
+
+// LockOption for lock options
+type LockOption func(*LockOptions)
+
+// WithLockTTL set lock session ttl function
+func WithLockTTL(ttl int) LockOption {
+	return func(o *LockOptions) {
+		o.TTL = ttl
+	}
+}
+
+// WithLockDelay set lock delay function
+func WithLockDelay(lockDelay int) LockOption {
+	return func(o *LockOptions) {
+		o.LockDelay = lockDelay
+	}
+}
+
+// WithLockValue set lock value function
+func WithLockValue(value []byte) LockOption {
+	return func(o *LockOptions) {
+		o.Value = value
+	}
+}
+
+// WithLockTryOnce set try once function
+func WithLockTryOnce() LockOption {
+	return func(o *LockOptions) {
+		o.TryOnce = true
+	}
+}
+
+// NewLockOptions applies the options, the ttl defaults to 15 seconds
+func NewLockOptions(opts ...LockOption) LockOptions {
+	o := LockOptions{TTL: 15, LockDelay: -1}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.TTL < 10 {
+		// the minimum session ttl of Consul
+		o.TTL = 10
+	}
+	return o
+}
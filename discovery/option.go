@@ -1,33 +1,74 @@
 package discovery
 
 import (
+	"context"
 	"fmt"
 	"google.golang.org/grpc"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// Check status values reported by TTL heartbeats
+const (
+	HealthPassing  = "passing"
+	HealthWarning  = "warning"
+	HealthCritical = "critical"
+)
+
 type CheckResponse struct {
 	Url        string
 	healthy    string
+	status     string
 	onTime     int64
 	RetryCount int
+	mu         sync.RWMutex
 }
 
 type HttpRouter func(r *CheckResponse)
 
 func (r *CheckResponse) Result() string {
-	r.onTime = time.Now().Unix()
+	atomic.StoreInt64(&r.onTime, time.Now().Unix())
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	return r.healthy
 }
 
 func (r *CheckResponse) GetOnTime() int64 {
-	return r.onTime
+	return atomic.LoadInt64(&r.onTime)
 }
 
 func (r *CheckResponse) SetHealthy(healthy string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	r.healthy = healthy
 }
 
+// Output returns the check output without marking the check answered
+func (r *CheckResponse) Output() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.healthy
+}
+
+// Status returns the status reported by TTL heartbeats, passing by default
+func (r *CheckResponse) Status() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.status == "" {
+		return HealthPassing
+	}
+	return r.status
+}
+
+// SetStatus set the status (passing, warning, critical) and output reported by TTL heartbeats
+func (r *CheckResponse) SetStatus(status string, output string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status = status
+	r.healthy = output
+}
+
 // Option for queue system
 type Option func(*Config)
 
@@ -82,7 +123,7 @@ func WithCheckPort(port int) Option {
 	}
 }
 
-// WithTags set tags function
+// WithTags set tags function, the tags are not versions, see WithVersion
 func WithTags(tags ...string) Option {
 	return func(cfg *Config) {
 		cfg.Tags = tags
@@ -126,7 +167,7 @@ func WithEnableHealthyStatus() Option {
 	}
 }
 
-// WithCheckType  检查类型 HTTP TCP GRPC
+// WithCheckType  检查类型 HTTP TCP GRPC TTL
 func WithCheckType(checkType string) Option {
 	return func(cfg *Config) {
 		cfg.CheckType = checkType
@@ -167,9 +208,104 @@ func WithCheckGrpc(s grpc.ServiceRegistrar) Option {
 	}
 }
 
+// WithCheckTTL set TTL check function, the client reports CheckResponse to Consul every interval
+func WithCheckTTL() Option {
+	return func(cfg *Config) {
+		cfg.CheckType = "TTL"
+		cfg.CheckPath = ""
+	}
+}
+
+// WithChecks append additional health checks function
+func WithChecks(checks ...CheckConfig) Option {
+	return func(cfg *Config) {
+		cfg.Checks = append(cfg.Checks, checks...)
+	}
+}
+
+// WithVersion set version function, DefaultVersion by default
+func WithVersion(version string) Option {
+	return func(cfg *Config) {
+		cfg.Version = version
+	}
+}
+
+// WithMetadata set metadata function
+func WithMetadata(metadata map[string]string) Option {
+	return func(cfg *Config) {
+		if cfg.Metadata == nil {
+			cfg.Metadata = make(map[string]string, len(metadata))
+		}
+		for k, v := range metadata {
+			cfg.Metadata[k] = v
+		}
+	}
+}
+
+// WithWeights set weights function, the warning weight is used while a check is warning
+func WithWeights(passing int, warning int) Option {
+	return func(cfg *Config) {
+		if passing <= 0 {
+			passing = 1
+		}
+		if warning <= 0 {
+			warning = 1
+		}
+		cfg.WeightPassing = passing
+		cfg.WeightWarning = warning
+	}
+}
+
 // WithToken set WithToken  token
 func WithToken(token string) Option {
 	return func(cfg *Config) {
 		cfg.Token = token
 	}
 }
+
+// WithOnUnhealthy set the unhealthy callback function, called when the health self-check goes stale
+func WithOnUnhealthy(callback func()) Option {
+	return func(cfg *Config) {
+		cfg.OnUnhealthy = UnhealthyCallback
+		cfg.UnhealthyCallback = callback
+	}
+}
+
+// WithUnhealthyCancel cancel the context when the health self-check goes stale
+func WithUnhealthyCancel(cancel context.CancelFunc) Option {
+	return func(cfg *Config) {
+		cfg.OnUnhealthy = UnhealthyCancel
+		cfg.UnhealthyCancel = cancel
+	}
+}
+
+// WithUnhealthyPolicy set the policy applied when the health self-check goes stale
+func WithUnhealthyPolicy(policy UnhealthyPolicy) Option {
+	return func(cfg *Config) {
+		cfg.OnUnhealthy = policy
+	}
+}
+
+// WithOnHeartbeatError set the callback function of the TTL heartbeat errors
+func WithOnHeartbeatError(callback func(err error)) Option {
+	return func(cfg *Config) {
+		cfg.OnHeartbeatError = callback
+	}
+}
+
+// WithDrainTime set the seconds to wait before deregister on shutdown
+func WithDrainTime(drainTime int) Option {
+	return func(cfg *Config) {
+		if drainTime < 0 {
+			drainTime = 0
+		}
+		cfg.DrainTime = drainTime
+	}
+}
+
+// WithShutdownNotServing set the gRPC health status to NOT_SERVING before draining on shutdown
+func WithShutdownNotServing() Option {
+	return func(cfg *Config) {
+		cfg.ShutdownNotServing = true
+	}
+}
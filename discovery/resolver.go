@@ -0,0 +1,85 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrServiceNotFound is returned by GetService when no instance matches
+var ErrServiceNotFound = errors.New("service not found")
+
+// Resolver is a one-shot service lookup
+type Resolver interface {
+	// GetService returns the instances of a service grouped by version
+	GetService(ctx context.Context, name string, filters ...Filter) ([]*Service, error)
+	// ListServices returns the registered services, without nodes
+	ListServices(ctx context.Context) ([]*Service, error)
+}
+
+// FilterOptions for service lookups
+type FilterOptions struct {
+	// Tags the instances must all have
+	Tags []string
+	// PassingOnly drops the instances with a non passing check
+	PassingOnly bool
+}
+
+// Filter for service lookups
+type Filter func(*FilterOptions)
+
+// FilterTags set tags filter function
+func FilterTags(tags ...string) Filter {
+	return func(o *FilterOptions) {
+		o.Tags = append(o.Tags, tags...)
+	}
+}
+
+// FilterPassingOnly set passing only filter function
+func FilterPassingOnly() Filter {
+	return func(o *FilterOptions) {
+		o.PassingOnly = true
+	}
+}
+
+// NewFilterOptions applies the filters
+func NewFilterOptions(filters ...Filter) FilterOptions {
+	var o FilterOptions
+	for _, f := range filters {
+		f(&o)
+	}
+	return o
+}
+
+// HasTags reports whether tags contains all the required tags
+func HasTags(tags []string, required []string) bool {
+	for _, r := range required {
+		var found bool
+		for _, tag := range tags {
+			if tag == r {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// GroupByVersion groups the instances into one service per version, versions are in order of appearance
+func GroupByVersion(name string, nodes []ServiceInstance) []*Service {
+	var services []*Service
+	index := make(map[string]*Service)
+	for _, node := range nodes {
+		version := ServiceVersion(node.GetMetadata(), node.GetTags())
+		svc, ok := index[version]
+		if !ok {
+			svc = &Service{Name: name, Version: version}
+			index[version] = svc
+			services = append(services, svc)
+		}
+		svc.Nodes = append(svc.Nodes, node)
+	}
+	return services
+}
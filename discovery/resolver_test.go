@@ -0,0 +1,20 @@
+package discovery
+
+import "testing"
+
+func TestHasTags(t *testing.T) {
+	for _, c := range []struct {
+		tags     []string
+		required []string
+		want     bool
+	}{
+		{tags: []string{"a", "b"}, required: []string{"b", "a"}, want: true},
+		{tags: []string{"a"}, required: []string{"a", "b"}, want: false},
+		{tags: []string{"a"}, want: true},
+		{required: []string{"a"}, want: false},
+	} {
+		if got := HasTags(c.tags, c.required); got != c.want {
+			t.Errorf("HasTags(%v, %v) = %v, want %v", c.tags, c.required, got, c.want)
+		}
+	}
+}
@@ -1,5 +1,14 @@
 package discovery
 
+import "strings"
+
+// MetadataVersionKey is the metadata key carrying the service version
+const MetadataVersionKey = "version"
+
+// DefaultVersion is the version the clients register without WithVersion.
+// It was a "v0.0.1" tag, tags are no longer read as versions.
+const DefaultVersion = "v0.0.1"
+
 type Service struct {
 	Name     string            `json:"name"`
 	Version  string            `json:"version"`
@@ -7,6 +16,20 @@ type Service struct {
 	Nodes    []ServiceInstance `json:"nodes"`
 }
 
+// ServiceVersion returns the version of a service instance from the version meta key
+// or a "version=" tag, in that order. Other tags, e.g. "v1.0.0", are not versions.
+func ServiceVersion(meta map[string]string, tags []string) string {
+	if v, ok := meta[MetadataVersionKey]; ok && v != "" {
+		return v
+	}
+	for _, tag := range tags {
+		if strings.HasPrefix(tag, MetadataVersionKey+"=") {
+			return strings.TrimPrefix(tag, MetadataVersionKey+"=")
+		}
+	}
+	return ""
+}
+
 // ServiceInstance is the model class of an instance of a service, which is used for service registration and discovery.
 type ServiceInstance interface {
 
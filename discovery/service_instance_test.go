@@ -0,0 +1,20 @@
+package discovery
+
+import "testing"
+
+func TestServiceVersion(t *testing.T) {
+	for _, c := range []struct {
+		meta map[string]string
+		tags []string
+		want string
+	}{
+		{meta: map[string]string{MetadataVersionKey: "1.0.0"}, tags: []string{"version=2.0.0"}, want: "1.0.0"},
+		{meta: map[string]string{MetadataVersionKey: ""}, tags: []string{"a", "version=2.0.0"}, want: "2.0.0"},
+		{tags: []string{"v1.0.0", "v2"}, want: ""},
+		{want: ""},
+	} {
+		if got := ServiceVersion(c.meta, c.tags); got != c.want {
+			t.Errorf("ServiceVersion(%v, %v) = %q, want %q", c.meta, c.tags, got, c.want)
+		}
+	}
+}
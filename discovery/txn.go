@@ -0,0 +1,94 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// ErrConflict is returned by check-and-set writes when the modify index of the key does not match
+	ErrConflict = errors.New("kv modify index conflict")
+	// ErrTxnAborted is returned when an operation of a transaction fails, no operation is applied
+	ErrTxnAborted = errors.New("kv transaction aborted")
+)
+
+// TxnVerb is the operation of a transaction step
+type TxnVerb string
+
+const (
+	// TxnGet reads the key, the transaction fails if it does not exist
+	TxnGet TxnVerb = "get"
+	// TxnSet writes the key
+	TxnSet TxnVerb = "set"
+	// TxnDelete removes the key
+	TxnDelete TxnVerb = "delete"
+	// TxnCheckIndex fails the transaction if the modify index of the key is not Index
+	TxnCheckIndex TxnVerb = "check-index"
+	// TxnCAS writes the key if its modify index is Index, an Index of 0 only creates the key
+	TxnCAS TxnVerb = "cas"
+)
+
+// TxnOp is a step of a transaction
+type TxnOp struct {
+	Verb  TxnVerb
+	Key   string
+	Value []byte
+	Index uint64
+	// Flags of the written key, dropped by the stores that do not keep flags
+	Flags uint64
+}
+
+// Txn is a list of operations applied all or nothing
+type Txn struct {
+	Ops []TxnOp
+}
+
+// NewTxn returns an empty transaction
+func NewTxn() *Txn {
+	return &Txn{}
+}
+
+// Get adds a read of the key
+func (t *Txn) Get(key string) *Txn {
+	t.Ops = append(t.Ops, TxnOp{Verb: TxnGet, Key: key})
+	return t
+}
+
+// Set adds a write of the key
+func (t *Txn) Set(key string, value string) *Txn {
+	t.Ops = append(t.Ops, TxnOp{Verb: TxnSet, Key: key, Value: []byte(value)})
+	return t
+}
+
+// Delete adds a removal of the key
+func (t *Txn) Delete(key string) *Txn {
+	t.Ops = append(t.Ops, TxnOp{Verb: TxnDelete, Key: key})
+	return t
+}
+
+// CASPair adds a write of the value and flags of the pair if the modify index of the key is pair.ModifyIndex,
+// a ModifyIndex of 0 only creates the key
+func (t *Txn) CASPair(pair *KVPair) *Txn {
+	t.Ops = append(t.Ops, TxnOp{Verb: TxnCAS, Key: pair.Key, Value: pair.Value, Index: pair.ModifyIndex, Flags: pair.Flags})
+	return t
+}
+
+// CheckIndex adds a check that the key is unchanged since index
+func (t *Txn) CheckIndex(key string, index uint64) *Txn {
+	t.Ops = append(t.Ops, TxnOp{Verb: TxnCheckIndex, Key: key, Index: index})
+	return t
+}
+
+// TxnKV is a KV supporting check-and-set writes and transactions
+type TxnKV interface {
+	KV
+	// CompareAndSet writes the key if its modify index is index, an index of 0 only creates the key.
+	// It returns an error wrapping ErrConflict when the key was changed.
+	CompareAndSet(ctx context.Context, key string, value string, index uint64) error
+	// DeleteCAS removes the key if its modify index is index, a missing key is not an error.
+	// It returns an error wrapping ErrConflict when the key was changed.
+	DeleteCAS(ctx context.Context, key string, index uint64) error
+	// Txn applies the operations atomically and returns the pairs read by the get operations in order.
+	// It returns an error wrapping ErrTxnAborted when an operation fails.
+	Txn(ctx context.Context, txn *Txn) ([]*KVPair, error)
+}
@@ -0,0 +1,94 @@
+package etcd
+
+import (
+	"net"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+// testServer is a single member etcd server embedded in the test
+type testServer struct {
+	etcd *embed.Etcd
+	port int
+	// raw is a plain client of the server
+	raw *clientv3.Client
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	clientURL, peerURL := freeURL(t), freeURL(t)
+
+	cfg := embed.NewConfig()
+	cfg.Dir = t.TempDir()
+	cfg.LogLevel = "error"
+	cfg.ListenClientUrls = []url.URL{clientURL}
+	cfg.AdvertiseClientUrls = []url.URL{clientURL}
+	cfg.ListenPeerUrls = []url.URL{peerURL}
+	cfg.AdvertisePeerUrls = []url.URL{peerURL}
+	cfg.InitialCluster = cfg.Name + "=" + peerURL.String()
+
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(e.Close)
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		t.Fatal("etcd server not ready")
+	}
+
+	raw, err := clientv3.New(clientv3.Config{Endpoints: []string{clientURL.Host}, DialTimeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = raw.Close() })
+
+	port, _ := strconv.Atoi(clientURL.Port())
+	return &testServer{etcd: e, port: port, raw: raw}
+}
+
+// newClient returns a client of the server closed with the test
+func (s *testServer) newClient(t *testing.T, opts ...discovery.Option) *Client {
+	t.Helper()
+	opts = append([]discovery.Option{
+		discovery.WithRegisterAddr("127.0.0.1"),
+		discovery.WithRegisterPort(s.port),
+		discovery.WithName("svc"),
+		discovery.WithDeregisterTime(minTTL),
+	}, opts...)
+	client, err := New(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+func freeURL(t *testing.T) url.URL {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return url.URL{Scheme: "http", Host: l.Addr().String()}
+}
+
+// eventually fails the test when cond is not met within timeout
+func eventually(t *testing.T, timeout time.Duration, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
@@ -0,0 +1,111 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+	"github.com/pkg/errors"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+var _ discovery.TxnKV = (*Client)(nil)
+
+// CompareAndSet writes the key if its mod revision is index, an index of 0 only creates the key
+func (s *Client) CompareAndSet(ctx context.Context, key string, value string, index uint64) error {
+	cmp := clientv3.Compare(clientv3.ModRevision(key), "=", int64(index))
+	if index == 0 {
+		cmp = clientv3.Compare(clientv3.CreateRevision(key), "=", 0)
+	}
+	resp, err := s.client.Txn(ctx).If(cmp).Then(clientv3.OpPut(key, value)).Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return errors.Wrapf(discovery.ErrConflict, "cas kv error[key=%s,index=%d]", key, index)
+	}
+	return nil
+}
+
+// DeleteCAS removes the key if its mod revision is index, a missing key is not an error
+func (s *Client) DeleteCAS(ctx context.Context, key string, index uint64) error {
+	resp, err := s.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(key), "=", int64(index))).
+		Then(clientv3.OpDelete(key)).
+		Else(clientv3.OpGet(key, clientv3.WithCountOnly())).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded && resp.Responses[0].GetResponseRange().Count > 0 {
+		return errors.Wrapf(discovery.ErrConflict, "delete cas kv error[key=%s,index=%d]", key, index)
+	}
+	return nil
+}
+
+// Txn applies the operations in one etcd transaction, the get and check-index operations become compares.
+// A get after a write in the same transaction reads the written value, as consul and memory do.
+// A key checked after being written cannot be compared and aborts the transaction, so does a key written twice.
+func (s *Client) Txn(ctx context.Context, txn *discovery.Txn) ([]*discovery.KVPair, error) {
+	var cmps []clientv3.Cmp
+	var ops []clientv3.Op
+	// written is the last write of the keys, the ranges of a transaction see its earlier writes
+	written := make(map[string]discovery.TxnVerb)
+	for i, op := range txn.Ops {
+		switch op.Verb {
+		case discovery.TxnGet:
+			switch written[op.Key] {
+			case discovery.TxnDelete:
+				return nil, errors.Wrapf(discovery.ErrTxnAborted, "op %d: key %q doesn't exist", i, op.Key)
+			case "":
+				cmps = append(cmps, clientv3.Compare(clientv3.CreateRevision(op.Key), ">", 0))
+			}
+			ops = append(ops, clientv3.OpGet(op.Key))
+		case discovery.TxnCheckIndex:
+			if written[op.Key] != "" {
+				return nil, errors.Wrapf(discovery.ErrTxnAborted, "op %d: key %q is written earlier in the transaction", i, op.Key)
+			}
+			cmps = append(cmps, clientv3.Compare(clientv3.ModRevision(op.Key), "=", int64(op.Index)))
+		case discovery.TxnCAS:
+			if written[op.Key] != "" {
+				return nil, errors.Wrapf(discovery.ErrTxnAborted, "op %d: key %q is written earlier in the transaction", i, op.Key)
+			}
+			if op.Index == 0 {
+				cmps = append(cmps, clientv3.Compare(clientv3.CreateRevision(op.Key), "=", 0))
+			} else {
+				cmps = append(cmps, clientv3.Compare(clientv3.ModRevision(op.Key), "=", int64(op.Index)))
+			}
+			written[op.Key] = op.Verb
+			ops = append(ops, clientv3.OpPut(op.Key, string(op.Value)))
+		case discovery.TxnSet:
+			written[op.Key] = op.Verb
+			ops = append(ops, clientv3.OpPut(op.Key, string(op.Value)))
+		case discovery.TxnDelete:
+			written[op.Key] = op.Verb
+			ops = append(ops, clientv3.OpDelete(op.Key))
+		default:
+			return nil, errors.Errorf("unknown txn verb %q", op.Verb)
+		}
+	}
+
+	resp, err := s.client.Txn(ctx).If(cmps...).Then(ops...).Commit()
+	if errors.Is(err, rpctypes.ErrDuplicateKey) {
+		// etcd rejects a key written twice in a transaction
+		return nil, errors.Wrap(discovery.ErrTxnAborted, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Succeeded {
+		return nil, errors.Wrap(discovery.ErrTxnAborted, fmt.Sprintf("compare failed at revision %d", resp.Header.Revision))
+	}
+
+	var pairs []*discovery.KVPair
+	for _, r := range resp.Responses {
+		if rr := r.GetResponseRange(); rr != nil && len(rr.Kvs) > 0 {
+			pairs = append(pairs, newKVPair(rr.Kvs[0]))
+		}
+	}
+	return pairs, nil
+}
@@ -0,0 +1,121 @@
+package etcd
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+var _ discovery.KVWatcher = (*Client)(nil)
+
+// WatchKey sends the value of the key on every change using an etcd watch
+func (s *Client) WatchKey(ctx context.Context, key string) (<-chan discovery.KVUpdate, error) {
+	return s.watchKV(ctx, key, false), nil
+}
+
+// WatchPrefix sends the changed keys under the prefix on every change using an etcd watch
+func (s *Client) WatchPrefix(ctx context.Context, prefix string) (<-chan discovery.KVUpdate, error) {
+	return s.watchKV(ctx, prefix, true), nil
+}
+
+// watchKV reads the current keys then watches from the next revision,
+// the keys are read again when the watch fails, e.g. on compaction
+func (s *Client) watchKV(ctx context.Context, key string, prefix bool) <-chan discovery.KVUpdate {
+	var opts []clientv3.OpOption
+	if prefix {
+		opts = append(opts, clientv3.WithPrefix())
+	}
+	ch := make(chan discovery.KVUpdate, 1)
+	go func() {
+		defer close(ch)
+		send := func(update discovery.KVUpdate) bool {
+			select {
+			case <-ctx.Done():
+				return false
+			case ch <- update:
+				return true
+			}
+		}
+
+		known := make(map[string]int64)
+		// loaded is set after the first read, a key missing at the start is sent as deleted
+		var loaded bool
+		for {
+			resp, err := s.client.Get(ctx, key, opts...)
+			if err != nil {
+				if !sleep(ctx, retryTime) {
+					return
+				}
+				continue
+			}
+
+			current := make(map[string]int64, len(resp.Kvs))
+			for _, kv := range resp.Kvs {
+				current[string(kv.Key)] = kv.ModRevision
+				if old, ok := known[string(kv.Key)]; !ok || old != kv.ModRevision {
+					if !send(discovery.KVUpdate{Key: string(kv.Key), Value: kv.Value, ModifyIndex: uint64(kv.ModRevision)}) {
+						return
+					}
+				}
+			}
+			var deleted []string
+			for k := range known {
+				if _, ok := current[k]; !ok {
+					deleted = append(deleted, k)
+				}
+			}
+			sort.Strings(deleted)
+			for _, k := range deleted {
+				if !send(discovery.KVUpdate{Key: k, ModifyIndex: uint64(resp.Header.Revision), Deleted: true}) {
+					return
+				}
+			}
+			if !loaded && !prefix && len(resp.Kvs) == 0 {
+				if !send(discovery.KVUpdate{Key: key, ModifyIndex: uint64(resp.Header.Revision), Deleted: true}) {
+					return
+				}
+			}
+			loaded = true
+			known = current
+
+			wctx, cancel := context.WithCancel(clientv3.WithRequireLeader(ctx))
+			for wresp := range s.client.Watch(wctx, key, append(opts, clientv3.WithRev(resp.Header.Revision+1))...) {
+				if wresp.Err() != nil {
+					break
+				}
+				for _, e := range wresp.Events {
+					k := string(e.Kv.Key)
+					update := discovery.KVUpdate{Key: k, Value: e.Kv.Value, ModifyIndex: uint64(e.Kv.ModRevision)}
+					if e.Type == mvccpb.DELETE {
+						delete(known, k)
+						update.Value, update.Deleted = nil, true
+					} else {
+						known[k] = e.Kv.ModRevision
+					}
+					if !send(update) {
+						cancel()
+						return
+					}
+				}
+			}
+			cancel()
+			if !sleep(ctx, retryTime) {
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
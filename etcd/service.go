@@ -0,0 +1,100 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+	"github.com/pkg/errors"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// ServicePrefix is the prefix of the registered instances, keyed by ServicePrefix/<name>/<id>
+const ServicePrefix = "discovery/services/"
+
+// minTTL is the shortest lease of a registration in seconds
+const minTTL = 5
+
+// retryTime is the wait before retrying a failed registration or watch
+const retryTime = time.Second
+
+var (
+	_ discovery.Discovery = (*Client)(nil)
+	_ discovery.KV        = (*Client)(nil)
+)
+
+// Client implements discovery.Discovery, discovery.KV and watches on top of etcd.
+// Registrations are bound to a lease kept alive by the client, they expire when the process dies.
+type Client struct {
+	client  *clientv3.Client
+	options *discovery.Config
+
+	registerLocker sync.Mutex
+	// cancel stops the keep alive of the registration
+	cancel context.CancelFunc
+	lease  clientv3.LeaseID
+}
+
+// New returns a client of the etcd endpoint RegisterAddr:RegisterPort
+func New(opts ...discovery.Option) (*Client, error) {
+	cfg := &discovery.Config{
+		Id:             fmt.Sprintf("xd%d", time.Now().UnixMilli()),
+		Name:           "Service",
+		RegisterAddr:   "127.0.0.1",
+		RegisterPort:   2379,
+		CheckAddr:      "127.0.0.1",
+		CheckPort:      80,
+		Version:        discovery.DefaultVersion,
+		IntervalTime:   15,
+		DeregisterTime: 15,
+		TimeOut:        3,
+		CheckResponse:  &discovery.CheckResponse{RetryCount: 3},
+		NodeAddr:       map[string]string{},
+	}
+	cfg.CheckResponse.SetHealthy("Healthy")
+	cfg.HttpRouter = func(r *discovery.CheckResponse) {}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	endpoint := fmt.Sprintf("%s:%d", cfg.RegisterAddr, cfg.RegisterPort)
+	timeout := time.Duration(cfg.TimeOut) * time.Second
+	etcdCli, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{endpoint},
+		DialTimeout: timeout,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "create etcd client error")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if _, err = etcdCli.Status(ctx, endpoint); err != nil {
+		_ = etcdCli.Close()
+		return nil, errors.Wrapf(err, "etcd status error[endpoint=%s]", endpoint)
+	}
+
+	return &Client{client: etcdCli, options: cfg}, nil
+}
+
+// SetTags set tags []string
+func (s *Client) SetTags(tags ...string) {
+	s.options.Tags = tags
+}
+
+// Close stops the keep alive of the registration and closes the etcd client
+func (s *Client) Close() error {
+	s.registerLocker.Lock()
+	if s.cancel != nil {
+		s.cancel()
+		s.cancel = nil
+	}
+	s.registerLocker.Unlock()
+	return s.client.Close()
+}
+
+func serviceKey(name, id string) string {
+	return ServicePrefix + name + "/" + id
+}
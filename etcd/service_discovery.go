@@ -0,0 +1,141 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+	"github.com/pkg/errors"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// Register puts the instance under a lease of DeregisterTime seconds and keeps the lease alive,
+// the instance is registered again if the lease is lost
+func (s *Client) Register() error {
+	s.registerLocker.Lock()
+	defer s.registerLocker.Unlock()
+	if s.cancel != nil {
+		s.cancel()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	keepAlive, err := s.register(ctx)
+	if err != nil {
+		cancel()
+		return errors.Wrapf(err, "register service error[key=%s]", s.options.Id)
+	}
+	s.cancel = cancel
+	go s.keepAlive(ctx, keepAlive)
+	return nil
+}
+
+func (s *Client) Deregister() error {
+	s.registerLocker.Lock()
+	defer s.registerLocker.Unlock()
+	if s.cancel != nil {
+		s.cancel()
+		s.cancel = nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(s.options.TimeOut)*time.Second)
+	defer cancel()
+	registered := s.lease != 0
+	if registered {
+		// revoking the lease deletes the key, a lease already expired has nothing left to revoke
+		_, err := s.client.Revoke(ctx, s.lease)
+		s.lease = 0
+		if err != nil && !errors.Is(err, rpctypes.ErrLeaseNotFound) {
+			return errors.Wrapf(err, "deregister service error[key=%s]", s.options.Id)
+		}
+	}
+	resp, err := s.client.Delete(ctx, serviceKey(s.options.Name, s.options.Id))
+	if err != nil {
+		return errors.Wrapf(err, "deregister service error[key=%s]", s.options.Id)
+	}
+	if !registered && resp.Deleted == 0 {
+		return errors.Wrapf(discovery.ErrServiceNotFound, "deregister service error[key=%s]", s.options.Id)
+	}
+	return nil
+}
+
+// register grants a lease, puts the instance with it and starts keeping it alive
+func (s *Client) register(ctx context.Context) (<-chan *clientv3.LeaseKeepAliveResponse, error) {
+	value, err := json.Marshal(s.instance())
+	if err != nil {
+		return nil, err
+	}
+	ttl := int64(s.options.DeregisterTime)
+	if ttl < minTTL {
+		ttl = minTTL
+	}
+
+	lease, err := s.client.Grant(ctx, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = s.client.Put(ctx, serviceKey(s.options.Name, s.options.Id), string(value), clientv3.WithLease(lease.ID)); err != nil {
+		s.revoke(lease.ID)
+		return nil, err
+	}
+	keepAlive, err := s.client.KeepAlive(ctx, lease.ID)
+	if err != nil {
+		s.revoke(lease.ID)
+		return nil, err
+	}
+	s.lease = lease.ID
+	return keepAlive, nil
+}
+
+// revoke revokes a lease that is not kept alive, rather than leave it and its key until the ttl
+func (s *Client) revoke(lease clientv3.LeaseID) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(s.options.TimeOut)*time.Second)
+	defer cancel()
+	_, _ = s.client.Revoke(ctx, lease)
+}
+
+// keepAlive drains the keep alive responses and registers again when the lease is lost, until ctx is done
+func (s *Client) keepAlive(ctx context.Context, keepAlive <-chan *clientv3.LeaseKeepAliveResponse) {
+	for {
+		for range keepAlive {
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(retryTime):
+			}
+			s.registerLocker.Lock()
+			if ctx.Err() != nil {
+				s.registerLocker.Unlock()
+				return
+			}
+			var err error
+			keepAlive, err = s.register(ctx)
+			s.registerLocker.Unlock()
+			if err == nil {
+				break
+			}
+		}
+	}
+}
+
+// instance returns the registered instance of the client
+func (s *Client) instance() *discovery.DefaultServiceInstance {
+	weight := s.options.WeightPassing
+	if weight <= 0 {
+		weight = 1
+	}
+	return &discovery.DefaultServiceInstance{
+		Id:          s.options.Id,
+		ServiceName: s.options.Name,
+		Host:        s.options.CheckAddr,
+		Port:        uint64(s.options.CheckPort),
+		Tags:        s.options.Tags,
+		Enable:      true,
+		Healthy:     true,
+		Weight:      float64(weight),
+		Metadata:    s.options.ServiceMetadata(),
+	}
+}
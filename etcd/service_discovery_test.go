@@ -0,0 +1,119 @@
+package etcd
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+	"github.com/pkg/errors"
+)
+
+func TestRegisterDeregister(t *testing.T) {
+	server := newTestServer(t)
+	client := server.newClient(t, discovery.WithId("a"), discovery.WithCheckPort(8080), discovery.WithVersion("1.0.0"))
+	ctx := context.Background()
+
+	if err := client.Register(); err != nil {
+		t.Fatal(err)
+	}
+	services, err := client.GetService(ctx, "svc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 1 || services[0].Version != "1.0.0" || len(services[0].Nodes) != 1 {
+		t.Fatalf("GetService = %+v", services)
+	}
+	if node := services[0].Nodes[0]; node.GetId() != "a" || node.GetPort() != 8080 {
+		t.Fatalf("node = %s:%d, want a:8080", node.GetId(), node.GetPort())
+	}
+
+	if err := client.Deregister(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetService(ctx, "svc"); !errors.Is(err, discovery.ErrServiceNotFound) {
+		t.Fatalf("GetService after Deregister = %v, want %v", err, discovery.ErrServiceNotFound)
+	}
+	if err := client.Deregister(); !errors.Is(err, discovery.ErrServiceNotFound) {
+		t.Fatalf("second Deregister = %v, want %v", err, discovery.ErrServiceNotFound)
+	}
+}
+
+func TestRegisterRevokesLease(t *testing.T) {
+	server := newTestServer(t)
+	// the instance is over the request size limit, the put fails after the lease is granted
+	big := map[string]string{"blob": strings.Repeat("x", 4<<20)}
+	client := server.newClient(t, discovery.WithId("a"), discovery.WithMetadata(big))
+	if err := client.Register(); err == nil {
+		t.Fatal("Register of an oversized instance succeeded")
+	}
+	leases, err := server.raw.Leases(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leases.Leases) != 0 {
+		t.Fatalf("%d leases left after the failed Register", len(leases.Leases))
+	}
+}
+
+func TestRegistrationExpires(t *testing.T) {
+	server := newTestServer(t)
+	client := server.newClient(t, discovery.WithId("a"))
+	if err := client.Register(); err != nil {
+		t.Fatal(err)
+	}
+
+	// closing the client stops the keep alive without revoking the lease
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, 3*minTTL*time.Second, func() bool {
+		resp, err := server.raw.Get(context.Background(), serviceKey("svc", "a"))
+		return err == nil && resp.Count == 0
+	})
+}
+
+func TestRegisterAgainAfterLeaseLost(t *testing.T) {
+	server := newTestServer(t)
+	client := server.newClient(t, discovery.WithId("a"))
+	ctx := context.Background()
+	if err := client.Register(); err != nil {
+		t.Fatal(err)
+	}
+
+	client.registerLocker.Lock()
+	lease := client.lease
+	client.registerLocker.Unlock()
+	if _, err := server.raw.Revoke(ctx, lease); err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, 10*time.Second, func() bool {
+		resp, err := server.raw.Get(ctx, serviceKey("svc", "a"))
+		return err == nil && resp.Count == 1 && resp.Kvs[0].Lease != int64(lease)
+	})
+
+	if err := client.Deregister(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeregisterLostLease(t *testing.T) {
+	server := newTestServer(t)
+	client := server.newClient(t, discovery.WithId("a"))
+	if err := client.Register(); err != nil {
+		t.Fatal(err)
+	}
+
+	client.registerLocker.Lock()
+	lease := client.lease
+	client.registerLocker.Unlock()
+	if _, err := server.raw.Revoke(context.Background(), lease); err != nil {
+		t.Fatal(err)
+	}
+	// the lease is gone before it is registered again, the instance is already deregistered
+	if err := client.Deregister(); err != nil {
+		t.Fatal(err)
+	}
+}
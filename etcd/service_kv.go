@@ -0,0 +1,105 @@
+package etcd
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+	"github.com/pkg/errors"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// etcd keys have no flags, so the client is not a discovery.PairSetter and kvbackup restores values only
+var _ discovery.ContextKV = (*Client)(nil)
+
+func (s *Client) Get(key string) ([]byte, error) {
+	return s.GetContext(context.Background(), key)
+}
+
+func (s *Client) Set(key string, value string) error {
+	return s.SetContext(context.Background(), key, value)
+}
+
+func (s *Client) Delete(key string) error {
+	return s.DeleteContext(context.Background(), key)
+}
+
+func (s *Client) List(key string) (map[string][]byte, error) {
+	return s.ListContext(context.Background(), key)
+}
+
+// GetContext returns the value of the key, or an error wrapping discovery.ErrNotFound
+func (s *Client) GetContext(ctx context.Context, key string) ([]byte, error) {
+	pair, err := s.GetPair(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return pair.Value, nil
+}
+
+func (s *Client) SetContext(ctx context.Context, key string, value string) error {
+	if _, err := s.client.Put(ctx, key, value); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Client) DeleteContext(ctx context.Context, key string) error {
+	if _, err := s.client.Delete(ctx, key); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ListContext returns the values under the prefix, or an error wrapping discovery.ErrNotFound
+func (s *Client) ListContext(ctx context.Context, key string) (map[string][]byte, error) {
+	pairs, err := s.ListPairs(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string][]byte, len(pairs))
+	for _, v := range pairs {
+		values[v.Key] = v.Value
+	}
+	return values, nil
+}
+
+// GetPair returns the key, ModifyIndex is the etcd mod revision and Session the hex id of its lease
+func (s *Client) GetPair(ctx context.Context, key string) (*discovery.KVPair, error) {
+	resp, err := s.client.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, errors.Wrapf(discovery.ErrNotFound, "get kv error[key=%s]", key)
+	}
+	return newKVPair(resp.Kvs[0]), nil
+}
+
+func (s *Client) ListPairs(ctx context.Context, prefix string) ([]*discovery.KVPair, error) {
+	resp, err := s.client.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, errors.Wrapf(discovery.ErrNotFound, "list kv error[prefix=%s]", prefix)
+	}
+	pairs := make([]*discovery.KVPair, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		pairs = append(pairs, newKVPair(kv))
+	}
+	return pairs, nil
+}
+
+func newKVPair(kv *mvccpb.KeyValue) *discovery.KVPair {
+	pair := &discovery.KVPair{
+		Key:         string(kv.Key),
+		Value:       kv.Value,
+		ModifyIndex: uint64(kv.ModRevision),
+	}
+	if kv.Lease != 0 {
+		pair.Session = strconv.FormatInt(kv.Lease, 16)
+	}
+	return pair
+}
@@ -0,0 +1,181 @@
+package etcd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+	"github.com/pkg/errors"
+)
+
+func TestKV(t *testing.T) {
+	client := newTestServer(t).newClient(t)
+
+	if _, err := client.Get("app/a"); !errors.Is(err, discovery.ErrNotFound) {
+		t.Fatalf("Get missing = %v, want %v", err, discovery.ErrNotFound)
+	}
+	if err := client.Set("app/a", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Set("app/b", "2"); err != nil {
+		t.Fatal(err)
+	}
+	value, err := client.Get("app/a")
+	if err != nil || string(value) != "1" {
+		t.Fatalf("Get = %q, %v, want 1", value, err)
+	}
+	values, err := client.List("app/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 2 || string(values["app/b"]) != "2" {
+		t.Fatalf("List = %v", values)
+	}
+	if err := client.Delete("app/a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Get("app/a"); !errors.Is(err, discovery.ErrNotFound) {
+		t.Fatalf("Get deleted = %v, want %v", err, discovery.ErrNotFound)
+	}
+}
+
+func TestCompareAndSet(t *testing.T) {
+	client := newTestServer(t).newClient(t)
+	ctx := context.Background()
+
+	if err := client.CompareAndSet(ctx, "a", "1", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CompareAndSet(ctx, "a", "1", 0); !errors.Is(err, discovery.ErrConflict) {
+		t.Fatalf("CompareAndSet existing = %v, want %v", err, discovery.ErrConflict)
+	}
+	pair, err := client.GetPair(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CompareAndSet(ctx, "a", "2", pair.ModifyIndex+1); !errors.Is(err, discovery.ErrConflict) {
+		t.Fatalf("CompareAndSet stale = %v, want %v", err, discovery.ErrConflict)
+	}
+	if err := client.CompareAndSet(ctx, "a", "2", pair.ModifyIndex); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.DeleteCAS(ctx, "a", pair.ModifyIndex); !errors.Is(err, discovery.ErrConflict) {
+		t.Fatalf("DeleteCAS stale = %v, want %v", err, discovery.ErrConflict)
+	}
+	pair, err = client.GetPair(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.DeleteCAS(ctx, "a", pair.ModifyIndex); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Get("a"); !errors.Is(err, discovery.ErrNotFound) {
+		t.Fatalf("Get after DeleteCAS = %v, want %v", err, discovery.ErrNotFound)
+	}
+}
+
+func TestTxn(t *testing.T) {
+	client := newTestServer(t).newClient(t)
+	ctx := context.Background()
+	if err := client.Set("a", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Set("b", "2"); err != nil {
+		t.Fatal(err)
+	}
+	pair, err := client.GetPair(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pairs, err := client.Txn(ctx, discovery.NewTxn().CheckIndex("a", pair.ModifyIndex).Get("b").Set("c", "3").Delete("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pairs) != 1 || pairs[0].Key != "b" || string(pairs[0].Value) != "2" {
+		t.Fatalf("Txn pairs = %+v", pairs)
+	}
+	if _, err := client.Get("a"); !errors.Is(err, discovery.ErrNotFound) {
+		t.Fatalf("Txn did not delete a: %v", err)
+	}
+
+	_, err = client.Txn(ctx, discovery.NewTxn().CheckIndex("b", pair.ModifyIndex).Set("d", "4"))
+	if !errors.Is(err, discovery.ErrTxnAborted) {
+		t.Fatalf("Txn with a stale index = %v, want %v", err, discovery.ErrTxnAborted)
+	}
+	if _, err := client.Get("d"); !errors.Is(err, discovery.ErrNotFound) {
+		t.Fatalf("aborted Txn wrote d: %v", err)
+	}
+}
+
+func TestTxnReadAfterWrite(t *testing.T) {
+	client := newTestServer(t).newClient(t)
+	ctx := context.Background()
+	if err := client.Set("a", "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the gets read the values written earlier in the transaction
+	pairs, err := client.Txn(ctx, discovery.NewTxn().Set("a", "2").Get("a").Set("b", "3").Get("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pairs) != 2 || string(pairs[0].Value) != "2" || string(pairs[1].Value) != "3" {
+		t.Fatalf("Txn pairs = %+v, want a=2 and b=3", pairs)
+	}
+
+	for name, txn := range map[string]*discovery.Txn{
+		"get after delete": discovery.NewTxn().Delete("a").Get("a").Set("c", "4"),
+		"check after set":  discovery.NewTxn().Set("a", "5").CheckIndex("a", pairs[0].ModifyIndex).Set("c", "4"),
+		"set twice":        discovery.NewTxn().Set("a", "5").Set("a", "6").Set("c", "4"),
+	} {
+		if _, err = client.Txn(ctx, txn); !errors.Is(err, discovery.ErrTxnAborted) {
+			t.Fatalf("Txn %s = %v, want %v", name, err, discovery.ErrTxnAborted)
+		}
+	}
+	if _, err := client.Get("c"); !errors.Is(err, discovery.ErrNotFound) {
+		t.Fatalf("aborted Txn wrote c: %v", err)
+	}
+	if value, err := client.Get("a"); err != nil || string(value) != "2" {
+		t.Fatalf("Get a = %q, %v, want 2", value, err)
+	}
+}
+
+func TestWatchKey(t *testing.T) {
+	client := newTestServer(t).newClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	updates, err := client.WatchKey(ctx, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := func() discovery.KVUpdate {
+		t.Helper()
+		select {
+		case u := <-updates:
+			return u
+		case <-time.After(5 * time.Second):
+			t.Fatal("no update")
+		}
+		return discovery.KVUpdate{}
+	}
+
+	if u := next(); u.Key != "k" || !u.Deleted {
+		t.Fatalf("first update = %+v, want a deleted k", u)
+	}
+	if err := client.Set("k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if u := next(); u.Deleted || string(u.Value) != "v" {
+		t.Fatalf("update = %+v, want k=v", u)
+	}
+	if err := client.Delete("k"); err != nil {
+		t.Fatal(err)
+	}
+	if u := next(); u.Key != "k" || !u.Deleted {
+		t.Fatalf("update = %+v, want a deleted k", u)
+	}
+}
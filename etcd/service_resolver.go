@@ -0,0 +1,65 @@
+package etcd
+
+import (
+	"context"
+	"sort"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+	"github.com/pkg/errors"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+var _ discovery.Resolver = (*Client)(nil)
+
+// GetService returns the instances of a service grouped by version
+func (s *Client) GetService(ctx context.Context, name string, filters ...discovery.Filter) ([]*discovery.Service, error) {
+	o := discovery.NewFilterOptions(filters...)
+	resp, err := s.client.Get(ctx, ServicePrefix+name+"/", clientv3.WithPrefix())
+	if err != nil {
+		return nil, errors.Wrapf(err, "get service error[name=%s]", name)
+	}
+
+	var nodes []discovery.ServiceInstance
+	for _, kv := range resp.Kvs {
+		_, node, ok := decodeInstance(kv)
+		if !ok {
+			continue
+		}
+		if o.PassingOnly && !node.IsHealthy() {
+			continue
+		}
+		if !discovery.HasTags(node.GetTags(), o.Tags) {
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	if len(nodes) == 0 {
+		return nil, errors.Wrapf(discovery.ErrServiceNotFound, "get service error[name=%s]", name)
+	}
+	return discovery.GroupByVersion(name, nodes), nil
+}
+
+// ListServices returns the registered services
+func (s *Client) ListServices(ctx context.Context) ([]*discovery.Service, error) {
+	resp, err := s.client.Get(ctx, ServicePrefix, clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		return nil, errors.Wrap(err, "list services error")
+	}
+	seen := make(map[string]bool)
+	var names []string
+	for _, kv := range resp.Kvs {
+		name, _, ok := parseKey(string(kv.Key))
+		if !ok || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make([]*discovery.Service, 0, len(names))
+	for _, name := range names {
+		result = append(result, &discovery.Service{Name: name})
+	}
+	return result, nil
+}
@@ -0,0 +1,239 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+	"github.com/donetkit/contrib_discovery/watcher"
+	"github.com/pkg/errors"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+var _ watcher.EventWatcher = (*Watcher)(nil)
+
+// testHookSynced runs between the read of the instances and the watch from the next revision
+var testHookSynced = func() {}
+
+// Watcher emits the same create/update/delete results as the consul watcher from a prefix watch
+// on the registered instances. WatchOptions.Filter, a Consul expression, is not supported and fails Watch.
+// The instances live as long as their lease so they are all passing, WatchOptions.PassingOnly changes nothing.
+type Watcher struct {
+	client   *clientv3.Client
+	option   watcher.WatchOptions
+	queue    *watcher.Queue
+	stopOnce sync.Once
+	cancel   context.CancelFunc
+
+	// services are the instances keyed by service name and id
+	services map[string]map[string]*discovery.DefaultServiceInstance
+}
+
+// Watch returns a watcher of the registered instances, it is stopped when ctx (or WatchOptions.Context, if set) is done
+func (s *Client) Watch(ctx context.Context, opts ...watcher.WatchOption) (watcher.EventWatcher, error) {
+	w, err := newWatcher(s.client, append([]watcher.WatchOption{watcher.WatchContext(ctx)}, opts...)...)
+	if err != nil {
+		// a nil *Watcher would be a non-nil watcher.EventWatcher
+		return nil, err
+	}
+	return w, nil
+}
+
+func newWatcher(client *clientv3.Client, opts ...watcher.WatchOption) (*Watcher, error) {
+	var wo watcher.WatchOptions
+	for _, o := range opts {
+		o(&wo)
+	}
+	if wo.Filter != "" {
+		return nil, errors.Errorf("etcd does not support watch filters[filter=%s]", wo.Filter)
+	}
+	if wo.Context == nil {
+		wo.Context = context.Background()
+	}
+
+	ctx, cancel := context.WithCancel(wo.Context)
+	w := &Watcher{
+		client:   client,
+		option:   wo,
+		queue:    watcher.NewQueue(),
+		cancel:   cancel,
+		services: make(map[string]map[string]*discovery.DefaultServiceInstance),
+	}
+	go w.run(ctx)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			w.Stop()
+		case <-w.queue.Done():
+		}
+	}()
+	return w, nil
+}
+
+// run reads the instances then watches from the next revision,
+// the instances are read again when the watch fails, e.g. on compaction
+func (w *Watcher) run(ctx context.Context) {
+	prefix := ServicePrefix
+	if w.option.Service != "" {
+		prefix = ServicePrefix + w.option.Service + "/"
+	}
+	for {
+		resp, err := w.client.Get(ctx, prefix, clientv3.WithPrefix())
+		if err != nil {
+			if !sleep(ctx, retryTime) {
+				return
+			}
+			continue
+		}
+
+		current := make(map[string]map[string]*discovery.DefaultServiceInstance)
+		for _, kv := range resp.Kvs {
+			name, ins, ok := decodeInstance(kv)
+			if !ok {
+				continue
+			}
+			if current[name] == nil {
+				current[name] = make(map[string]*discovery.DefaultServiceInstance)
+			}
+			current[name][ins.Id] = ins
+		}
+		var names []string
+		for name := range current {
+			names = append(names, name)
+		}
+		for name := range w.services {
+			if _, ok := current[name]; !ok {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			before := nodes(w.services[name])
+			w.set(name, current[name])
+			w.changed(uint64(resp.Header.Revision), name, before, nodes(current[name]))
+		}
+
+		testHookSynced()
+		wctx, cancel := context.WithCancel(clientv3.WithRequireLeader(ctx))
+		for wresp := range w.client.Watch(wctx, prefix, clientv3.WithPrefix(), clientv3.WithRev(resp.Header.Revision+1)) {
+			if wresp.Err() != nil {
+				break
+			}
+			// apply the events of a revision together, keyed by service
+			changed := make(map[string][]discovery.ServiceInstance)
+			var order []string
+			for _, e := range wresp.Events {
+				name, id, ok := parseKey(string(e.Kv.Key))
+				if !ok {
+					continue
+				}
+				if _, seen := changed[name]; !seen {
+					changed[name] = nodes(w.services[name])
+					order = append(order, name)
+				}
+				if e.Type == mvccpb.DELETE {
+					if instances := w.services[name]; instances != nil {
+						delete(instances, id)
+						if len(instances) == 0 {
+							delete(w.services, name)
+						}
+					}
+					continue
+				}
+				if _, ins, ok := decodeInstance(e.Kv); ok {
+					if w.services[name] == nil {
+						w.services[name] = make(map[string]*discovery.DefaultServiceInstance)
+					}
+					w.services[name][id] = ins
+				}
+			}
+			for _, name := range order {
+				w.changed(uint64(wresp.Header.Revision), name, changed[name], nodes(w.services[name]))
+			}
+		}
+		cancel()
+		if !sleep(ctx, retryTime) {
+			return
+		}
+	}
+}
+
+func (w *Watcher) set(name string, instances map[string]*discovery.DefaultServiceInstance) {
+	if len(instances) == 0 {
+		delete(w.services, name)
+		return
+	}
+	w.services[name] = instances
+}
+
+func (w *Watcher) Next() (*watcher.Result, error) {
+	return w.queue.Next()
+}
+
+// Events returns the typed events of the watcher, with the etcd revision as Id.
+// Events and Next consume the same stream, use one of them.
+// The channel is closed when the watcher is stopped.
+func (w *Watcher) Events() <-chan watcher.Event {
+	return w.queue.Events()
+}
+
+func (w *Watcher) Stop() {
+	w.stopOnce.Do(func() {
+		w.queue.Close()
+		w.cancel()
+	})
+}
+
+// changed queues the events for the nodes of a service changing from before to after
+func (w *Watcher) changed(idx uint64, name string, before, after []discovery.ServiceInstance) {
+	if len(w.option.Service) > 0 && name != w.option.Service {
+		return
+	}
+	w.queue.Push(watcher.Diff(idx, name, w.option.Select(before), w.option.Select(after))...)
+}
+
+// parseKey returns the service name and instance id of a ServicePrefix/<name>/<id> key
+func parseKey(key string) (string, string, bool) {
+	name, id, ok := strings.Cut(strings.TrimPrefix(key, ServicePrefix), "/")
+	if !ok || name == "" || id == "" {
+		return "", "", false
+	}
+	return name, id, true
+}
+
+func decodeInstance(kv *mvccpb.KeyValue) (string, *discovery.DefaultServiceInstance, bool) {
+	name, id, ok := parseKey(string(kv.Key))
+	if !ok {
+		return "", nil, false
+	}
+	ins := new(discovery.DefaultServiceInstance)
+	if err := json.Unmarshal(kv.Value, ins); err != nil {
+		return "", nil, false
+	}
+	ins.Id, ins.ServiceName = id, name
+	return name, ins, true
+}
+
+// nodes returns copies of the instances sorted by id
+func nodes(instances map[string]*discovery.DefaultServiceInstance) []discovery.ServiceInstance {
+	if len(instances) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(instances))
+	for id := range instances {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	result := make([]discovery.ServiceInstance, 0, len(ids))
+	for _, id := range ids {
+		n := new(discovery.DefaultServiceInstance)
+		*n = *instances[id]
+		result = append(result, n)
+	}
+	return result
+}
@@ -0,0 +1,133 @@
+package etcd
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+	"github.com/donetkit/contrib_discovery/watcher"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func expectEvent(t *testing.T, events <-chan watcher.Event, typ watcher.EventType, version string, ids ...string) {
+	t.Helper()
+	var e watcher.Event
+	select {
+	case e = <-events:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("no event, want %s svc@%s", typ, version)
+	}
+	if e.Type != typ || e.Service.Name != "svc" || e.Service.Version != version {
+		t.Fatalf("event = %s %s@%s, want %s svc@%s", e.Type, e.Service.Name, e.Service.Version, typ, version)
+	}
+	var got []string
+	for _, node := range e.Service.Nodes {
+		got = append(got, node.GetId())
+	}
+	sort.Strings(got)
+	if strings.Join(got, ",") != strings.Join(ids, ",") {
+		t.Fatalf("%s svc@%s nodes = %v, want %v", typ, version, got, ids)
+	}
+}
+
+func TestWatcherEvents(t *testing.T) {
+	server := newTestServer(t)
+	a := server.newClient(t, discovery.WithId("a"), discovery.WithVersion("1.0.0"))
+	b := server.newClient(t, discovery.WithId("b"), discovery.WithVersion("1.0.0"))
+	if err := a.Register(); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := a.Watch(context.Background(), watcher.WatchService("svc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+	events := w.Events()
+	expectEvent(t, events, watcher.Create, "")
+	expectEvent(t, events, watcher.Create, "1.0.0", "a")
+
+	if err := b.Register(); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, events, watcher.Update, "1.0.0", "a", "b")
+
+	if err := a.Deregister(); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, events, watcher.Delete, "1.0.0", "a")
+	expectEvent(t, events, watcher.Update, "1.0.0", "b")
+
+	if err := b.Deregister(); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, events, watcher.Delete, "1.0.0", "b")
+	expectEvent(t, events, watcher.Delete, "")
+}
+
+func TestWatcherFilter(t *testing.T) {
+	server := newTestServer(t)
+	client := server.newClient(t)
+	w, err := client.Watch(context.Background(), watcher.WatchFilter(`Service.Meta.env == "prod"`))
+	if err == nil {
+		t.Fatal("Watch with a filter succeeded")
+	}
+	if w != nil {
+		t.Fatalf("Watch with a filter returned the watcher %#v", w)
+	}
+}
+
+// TestWatcherCompacted checks that the watcher reads the instances again when the revisions
+// following its read are compacted before it watches them
+func TestWatcherCompacted(t *testing.T) {
+	server := newTestServer(t)
+	a := server.newClient(t, discovery.WithId("a"), discovery.WithVersion("1.0.0"))
+	b := server.newClient(t, discovery.WithId("b"), discovery.WithVersion("2.0.0"))
+	if err := a.Register(); err != nil {
+		t.Fatal(err)
+	}
+
+	var once sync.Once
+	testHookSynced = func() {
+		once.Do(func() {
+			ctx := context.Background()
+			if err := b.Register(); err != nil {
+				t.Error(err)
+				return
+			}
+			resp, err := server.raw.Put(ctx, "unrelated", "1")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if _, err = server.raw.Compact(ctx, resp.Header.Revision, clientv3.WithCompactPhysical()); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	defer func() { testHookSynced = func() {} }()
+
+	w, err := a.Watch(context.Background(), watcher.WatchService("svc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+	events := w.Events()
+	expectEvent(t, events, watcher.Create, "")
+	expectEvent(t, events, watcher.Create, "1.0.0", "a")
+
+	// the registration of b was compacted, it is found by the second read
+	expectEvent(t, events, watcher.Update, "1.0.0", "a")
+	expectEvent(t, events, watcher.Create, "2.0.0", "b")
+
+	// the watch is running again
+	if err := a.Deregister(); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, events, watcher.Update, "2.0.0", "b")
+	expectEvent(t, events, watcher.Delete, "1.0.0", "a")
+}
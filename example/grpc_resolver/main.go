@@ -0,0 +1,23 @@
+package main
+
+import (
+	"log"
+
+	_ "github.com/donetkit/contrib_discovery/resolver"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func main() {
+	// 通过Consul解析gRPC服务地址
+	conn, err := grpc.Dial("consul://127.0.0.1:8500/my-service?tag=v1&healthy=true",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultServiceConfig(`{"loadBalancingConfig": [{"round_robin":{}}]}`),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+
+	log.Println(conn.GetState())
+}
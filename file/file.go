@@ -0,0 +1,236 @@
+package file
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Document is the content of a registry file, e.g. in YAML
+//
+//	services:
+//	  - id: api-1
+//	    name: api
+//	    host: 10.0.0.1
+//	    port: 8080
+//	    tags: [v1]
+//	kv:
+//	  app/gateway/consul/tags: "a,b"
+//	kv_flags:
+//	  app/gateway/consul/tags: 1
+type Document struct {
+	Services []*Instance       `json:"services" yaml:"services"`
+	KV       map[string]string `json:"kv,omitempty" yaml:"kv,omitempty"`
+	// KVFlags are the flags of the keys, keys without flags are omitted
+	KVFlags map[string]uint64 `json:"kv_flags,omitempty" yaml:"kv_flags,omitempty"`
+}
+
+// Instance is a service instance declared in a registry file, Enable and Healthy default to true
+type Instance struct {
+	Id       string            `json:"id,omitempty" yaml:"id,omitempty"`
+	Name     string            `json:"name" yaml:"name"`
+	Host     string            `json:"host" yaml:"host"`
+	Port     uint64            `json:"port" yaml:"port"`
+	Tags     []string          `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Weight   float64           `json:"weight,omitempty" yaml:"weight,omitempty"`
+	Cluster  string            `json:"cluster,omitempty" yaml:"cluster,omitempty"`
+	Group    string            `json:"group,omitempty" yaml:"group,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+	Enable   *bool             `json:"enable,omitempty" yaml:"enable,omitempty"`
+	Healthy  *bool             `json:"healthy,omitempty" yaml:"healthy,omitempty"`
+}
+
+// instance converts the declaration, an instance without id is identified by its address
+func (i *Instance) instance() *discovery.DefaultServiceInstance {
+	id := i.Id
+	if id == "" {
+		id = i.Host + ":" + strconv.FormatUint(i.Port, 10)
+	}
+	weight := i.Weight
+	if weight <= 0 {
+		weight = 1
+	}
+	return &discovery.DefaultServiceInstance{
+		Id:          id,
+		ServiceName: i.Name,
+		Host:        i.Host,
+		Port:        i.Port,
+		ClusterName: i.Cluster,
+		GroupName:   i.Group,
+		Tags:        append([]string(nil), i.Tags...),
+		Enable:      i.Enable == nil || *i.Enable,
+		Healthy:     i.Healthy == nil || *i.Healthy,
+		Weight:      weight,
+		Metadata:    i.Metadata,
+	}
+}
+
+// services returns the instances keyed by service name and id
+func (d *Document) services() map[string]map[string]*discovery.DefaultServiceInstance {
+	services := make(map[string]map[string]*discovery.DefaultServiceInstance)
+	for _, i := range d.Services {
+		if i.Name == "" {
+			continue
+		}
+		ins := i.instance()
+		if services[ins.ServiceName] == nil {
+			services[ins.ServiceName] = make(map[string]*discovery.DefaultServiceInstance)
+		}
+		services[ins.ServiceName][ins.Id] = ins
+	}
+	return services
+}
+
+// pair returns the key with its flags and modify index
+func (d *Document) pair(key string) (*discovery.KVPair, bool) {
+	value, ok := d.KV[key]
+	if !ok {
+		return nil, false
+	}
+	flags := d.KVFlags[key]
+	return &discovery.KVPair{Key: key, Value: []byte(value), ModifyIndex: modifyIndex(value, flags), Flags: flags}, true
+}
+
+// pairs returns the keys matching key, or starting with it when prefix is set, sorted by key
+func (d *Document) pairs(key string, prefix bool) []*discovery.KVPair {
+	var keys []string
+	for k := range d.KV {
+		if k == key || (prefix && strings.HasPrefix(k, key)) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	pairs := make([]*discovery.KVPair, 0, len(keys))
+	for _, k := range keys {
+		pair, _ := d.pair(k)
+		pairs = append(pairs, pair)
+	}
+	return pairs
+}
+
+// setPair writes the value and flags of the key
+func (d *Document) setPair(key string, value []byte, flags uint64) {
+	if d.KV == nil {
+		d.KV = make(map[string]string)
+	}
+	d.KV[key] = string(value)
+	if flags == 0 {
+		delete(d.KVFlags, key)
+		return
+	}
+	if d.KVFlags == nil {
+		d.KVFlags = make(map[string]uint64)
+	}
+	d.KVFlags[key] = flags
+}
+
+// deletePair removes the key and its flags
+func (d *Document) deletePair(key string) {
+	delete(d.KV, key)
+	delete(d.KVFlags, key)
+}
+
+// modifyIndex is the modify index of a key, a hash of its value and flags: the file keeps no history
+// and the hash also changes on the edits by hand, which the check-and-set writes then detect
+func modifyIndex(value string, flags uint64) uint64 {
+	h := fnv.New64a()
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], flags)
+	_, _ = h.Write(b[:])
+	_, _ = h.Write([]byte(value))
+	if index := h.Sum64(); index != 0 {
+		return index
+	}
+	// 0 only creates a key
+	return 1
+}
+
+// isYAML reports whether the file is read and written as YAML, other files are JSON
+func isYAML(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// load reads the file, a missing file is an empty document
+func load(path string) (*Document, []byte, error) {
+	buff, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &Document{}, nil, nil
+	}
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "read registry file error[path=%s]", path)
+	}
+	doc := &Document{}
+	if isYAML(path) {
+		err = yaml.Unmarshal(buff, doc)
+	} else if len(strings.TrimSpace(string(buff))) > 0 {
+		err = json.Unmarshal(buff, doc)
+	}
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "decode registry file error[path=%s]", path)
+	}
+	// drop the empty entries, e.g. a "-" line in YAML or null in JSON
+	services := doc.Services[:0]
+	for _, i := range doc.Services {
+		if i != nil {
+			services = append(services, i)
+		}
+	}
+	doc.Services = services
+	return doc, buff, nil
+}
+
+// save writes the file atomically with a temp file and a rename
+func save(path string, doc *Document) error {
+	sort.SliceStable(doc.Services, func(i, j int) bool {
+		return doc.Services[i].Name < doc.Services[j].Name
+	})
+	var buff []byte
+	var err error
+	if isYAML(path) {
+		var b bytes.Buffer
+		enc := yaml.NewEncoder(&b)
+		enc.SetIndent(2)
+		if err = enc.Encode(doc); err == nil {
+			err = enc.Close()
+		}
+		buff = b.Bytes()
+	} else {
+		buff, err = json.MarshalIndent(doc, "", "\t")
+	}
+	if err != nil {
+		return errors.Wrapf(err, "encode registry file error[path=%s]", path)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return errors.Wrapf(err, "write registry file error[path=%s]", path)
+	}
+	defer os.Remove(tmp.Name())
+	mode := os.FileMode(0644)
+	if info, statErr := os.Stat(path); statErr == nil {
+		mode = info.Mode().Perm()
+	}
+	if err = tmp.Chmod(mode); err == nil {
+		_, err = tmp.Write(buff)
+	}
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		_ = tmp.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	return errors.Wrapf(err, "write registry file error[path=%s]", path)
+}
@@ -0,0 +1,109 @@
+package file
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+	"github.com/pkg/errors"
+)
+
+func newTestClient(t *testing.T, path string, id string) *Client {
+	t.Helper()
+	client, err := New(path, discovery.WithId(id), discovery.WithName("svc"), discovery.WithVersion("1.0.0"),
+		discovery.WithCheckAddr("10.0.0.1"), discovery.WithCheckPort(8080))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, name := range []string{"registry.yaml", "registry.json"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			a := newTestClient(t, path, "a")
+			if err := a.Register(); err != nil {
+				t.Fatal(err)
+			}
+			if err := newTestClient(t, path, "b").Register(); err != nil {
+				t.Fatal(err)
+			}
+			if err := a.Set("app/a", "1"); err != nil {
+				t.Fatal(err)
+			}
+
+			// a second client reads what the first one wrote
+			reader := newTestClient(t, path, "reader")
+			services, err := reader.GetService(context.Background(), "svc")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(services) != 1 || services[0].Version != "1.0.0" || len(services[0].Nodes) != 2 {
+				t.Fatalf("GetService = %+v", services)
+			}
+			node := services[0].Nodes[0]
+			if node.GetId() != "a" || node.GetHost() != "10.0.0.1" || node.GetPort() != 8080 || !node.IsHealthy() {
+				t.Fatalf("node = %+v", node)
+			}
+			value, err := reader.Get("app/a")
+			if err != nil || string(value) != "1" {
+				t.Fatalf("Get = %q, %v, want 1", value, err)
+			}
+
+			if err := a.Deregister(); err != nil {
+				t.Fatal(err)
+			}
+			if err := a.Deregister(); !errors.Is(err, discovery.ErrServiceNotFound) {
+				t.Fatalf("second Deregister = %v, want %v", err, discovery.ErrServiceNotFound)
+			}
+			services, err = reader.GetService(context.Background(), "svc")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(services[0].Nodes) != 1 || services[0].Nodes[0].GetId() != "b" {
+				t.Fatalf("GetService after Deregister = %+v", services)
+			}
+		})
+	}
+}
+
+func TestNilEntries(t *testing.T) {
+	for name, content := range map[string]string{
+		"registry.yaml": "services:\n  -\n  - name: svc\n    id: x\n    host: 10.0.0.2\n    port: 80\n  -\n",
+		"registry.json": `{"services": [null, {"name": "svc", "id": "x", "host": "10.0.0.2", "port": 80}, null]}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			client := newTestClient(t, path, "a")
+			if err := client.Register(); err != nil {
+				t.Fatal(err)
+			}
+			if err := client.Deregister(); err != nil {
+				t.Fatal(err)
+			}
+			services, err := client.GetService(context.Background(), "svc")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(services) != 1 || len(services[0].Nodes) != 1 || services[0].Nodes[0].GetId() != "x" {
+				t.Fatalf("GetService = %+v", services)
+			}
+		})
+	}
+}
+
+func TestMissingFile(t *testing.T) {
+	client := newTestClient(t, filepath.Join(t.TempDir(), "registry.yaml"), "a")
+	if _, err := client.GetService(context.Background(), "svc"); !errors.Is(err, discovery.ErrServiceNotFound) {
+		t.Fatalf("GetService = %v, want %v", err, discovery.ErrServiceNotFound)
+	}
+	if _, err := client.Get("k"); !errors.Is(err, discovery.ErrNotFound) {
+		t.Fatalf("Get = %v, want %v", err, discovery.ErrNotFound)
+	}
+}
@@ -0,0 +1,94 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+	"github.com/pkg/errors"
+)
+
+var _ discovery.TxnKV = (*Client)(nil)
+
+// CompareAndSet writes the key if its modify index is index, an index of 0 only creates the key. The flags of the key are kept.
+func (s *Client) CompareAndSet(ctx context.Context, key string, value string, index uint64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.update(func(doc *Document) error {
+		pair, ok := doc.pair(key)
+		if (index == 0 && ok) || (index != 0 && (!ok || pair.ModifyIndex != index)) {
+			return errors.Wrapf(discovery.ErrConflict, "cas kv error[key=%s,index=%d]", key, index)
+		}
+		doc.setPair(key, []byte(value), doc.KVFlags[key])
+		return nil
+	})
+}
+
+// DeleteCAS removes the key if its modify index is index, a missing key is not an error
+func (s *Client) DeleteCAS(ctx context.Context, key string, index uint64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.update(func(doc *Document) error {
+		pair, ok := doc.pair(key)
+		if !ok {
+			return nil
+		}
+		if pair.ModifyIndex != index {
+			return errors.Wrapf(discovery.ErrConflict, "delete cas kv error[key=%s,index=%d]", key, index)
+		}
+		doc.deletePair(key)
+		return nil
+	})
+}
+
+// Txn applies the operations in order under the file lock, the file is written if every operation succeeds
+func (s *Client) Txn(ctx context.Context, txn *discovery.Txn) ([]*discovery.KVPair, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var gets []*discovery.KVPair
+	err := s.update(func(doc *Document) error {
+		var what []string
+		for i, op := range txn.Ops {
+			pair, ok := doc.pair(op.Key)
+			switch op.Verb {
+			case discovery.TxnGet:
+				if !ok {
+					what = append(what, fmt.Sprintf("op %d: key %q doesn't exist", i, op.Key))
+					continue
+				}
+				gets = append(gets, pair)
+			case discovery.TxnCheckIndex:
+				if !ok {
+					what = append(what, fmt.Sprintf("op %d: key %q doesn't exist", i, op.Key))
+				} else if pair.ModifyIndex != op.Index {
+					what = append(what, fmt.Sprintf("op %d: current modify index %d != %d", i, pair.ModifyIndex, op.Index))
+				}
+			case discovery.TxnSet:
+				doc.setPair(op.Key, op.Value, op.Flags)
+			case discovery.TxnCAS:
+				if (op.Index == 0 && ok) || (op.Index != 0 && (!ok || pair.ModifyIndex != op.Index)) {
+					what = append(what, fmt.Sprintf("op %d: failed to set key %q, index is stale", i, op.Key))
+					continue
+				}
+				doc.setPair(op.Key, op.Value, op.Flags)
+			case discovery.TxnDelete:
+				doc.deletePair(op.Key)
+			default:
+				what = append(what, fmt.Sprintf("op %d: unknown verb %q", i, op.Verb))
+			}
+		}
+		if len(what) > 0 {
+			// the document is not written back
+			return errors.Wrap(discovery.ErrTxnAborted, strings.Join(what, "; "))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return gets, nil
+}
@@ -0,0 +1,85 @@
+package file
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+)
+
+var _ discovery.KVWatcher = (*Client)(nil)
+
+// WatchKey sends the value of the key on every change, the file is read every PollTime
+func (s *Client) WatchKey(ctx context.Context, key string) (<-chan discovery.KVUpdate, error) {
+	return s.watchKV(ctx, key, false)
+}
+
+// WatchPrefix sends the changed keys under the prefix on every change, the file is read every PollTime
+func (s *Client) WatchPrefix(ctx context.Context, prefix string) (<-chan discovery.KVUpdate, error) {
+	return s.watchKV(ctx, prefix, true)
+}
+
+// watchKV polls the file, a file that cannot be read keeps the last keys.
+// The deleted keys are sent with a ModifyIndex of 0, the file has no index of its own.
+func (s *Client) watchKV(ctx context.Context, key string, prefix bool) (<-chan discovery.KVUpdate, error) {
+	// fail early on an unreadable file
+	doc, _, err := load(s.path)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan discovery.KVUpdate, 1)
+	go func() {
+		defer close(ch)
+		ticker := time.NewTicker(PollTime)
+		defer ticker.Stop()
+		known := make(map[string]uint64)
+		for first := true; ; first = false {
+			var updates []discovery.KVUpdate
+			pairs := doc.pairs(key, prefix)
+			current := make(map[string]uint64, len(pairs))
+			for _, pair := range pairs {
+				current[pair.Key] = pair.ModifyIndex
+				if old, ok := known[pair.Key]; !ok || old != pair.ModifyIndex {
+					updates = append(updates, discovery.KVUpdate{Key: pair.Key, Value: pair.Value, ModifyIndex: pair.ModifyIndex})
+				}
+			}
+			var deleted []string
+			for k := range known {
+				if _, ok := current[k]; !ok {
+					deleted = append(deleted, k)
+				}
+			}
+			sort.Strings(deleted)
+			for _, k := range deleted {
+				updates = append(updates, discovery.KVUpdate{Key: k, Deleted: true})
+			}
+			if first && !prefix && len(pairs) == 0 {
+				// the key is missing at the start
+				updates = append(updates, discovery.KVUpdate{Key: key, Deleted: true})
+			}
+			known = current
+
+			for _, update := range updates {
+				select {
+				case <-ctx.Done():
+					return
+				case ch <- update:
+				}
+			}
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+				if next, _, err := load(s.path); err == nil {
+					doc = next
+					break
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
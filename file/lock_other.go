@@ -0,0 +1,8 @@
+//go:build !unix
+
+package file
+
+// lockFile does not lock on the platforms without flock, the writes are only serialized within the process
+func lockFile(string) (func(), error) {
+	return func() {}, nil
+}
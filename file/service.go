@@ -0,0 +1,139 @@
+package file
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+	"github.com/pkg/errors"
+)
+
+var _ discovery.Discovery = (*Client)(nil)
+
+// Client implements discovery.Discovery, the KV interfaces (discovery.ContextKV, PairSetter, TxnKV, KVWatcher)
+// and watches on top of a YAML (.yaml, .yml) or JSON file.
+// Writes rewrite the whole file, comments of a YAML file are not kept.
+// The modify index of a key is a hash of its value and flags, the watches poll the file.
+type Client struct {
+	path    string
+	options *discovery.Config
+	// mu serializes the read-modify-write cycles of the clients of this process, a flock those of the processes
+	mu *sync.Mutex
+}
+
+var (
+	fileLocks   = make(map[string]*sync.Mutex)
+	fileLocksMu sync.Mutex
+)
+
+// New returns a client of the registry file at path, the file is created on the first write
+func New(path string, opts ...discovery.Option) (*Client, error) {
+	cfg := &discovery.Config{
+		Id:             fmt.Sprintf("xd%d", time.Now().UnixNano()),
+		Name:           "Service",
+		RegisterAddr:   "127.0.0.1",
+		RegisterPort:   8500,
+		CheckAddr:      "127.0.0.1",
+		CheckPort:      80,
+		Version:        discovery.DefaultVersion,
+		IntervalTime:   15,
+		DeregisterTime: 15,
+		TimeOut:        3,
+		CheckResponse:  &discovery.CheckResponse{RetryCount: 3},
+		CheckType:      "TCP",
+		NodeAddr:       map[string]string{},
+	}
+	cfg.CheckResponse.SetHealthy("Healthy")
+	cfg.HttpRouter = func(r *discovery.CheckResponse) {}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	// fail early on an unreadable file
+	if _, _, err := load(path); err != nil {
+		return nil, err
+	}
+
+	fileLocksMu.Lock()
+	defer fileLocksMu.Unlock()
+	mu, ok := fileLocks[path]
+	if !ok {
+		mu = new(sync.Mutex)
+		fileLocks[path] = mu
+	}
+	return &Client{path: path, options: cfg, mu: mu}, nil
+}
+
+// Path returns the path of the registry file
+func (s *Client) Path() string {
+	return s.path
+}
+
+// SetTags set tags []string
+func (s *Client) SetTags(tags ...string) {
+	s.options.Tags = tags
+}
+
+// Register appends the instance to the file, replacing a declaration with the same id
+func (s *Client) Register() error {
+	weight := s.options.WeightPassing
+	if weight <= 0 {
+		weight = 1
+	}
+	instance := &Instance{
+		Id:       s.options.Id,
+		Name:     s.options.Name,
+		Host:     s.options.CheckAddr,
+		Port:     uint64(s.options.CheckPort),
+		Tags:     append([]string(nil), s.options.Tags...),
+		Weight:   float64(weight),
+		Metadata: s.options.ServiceMetadata(),
+	}
+
+	err := s.update(func(doc *Document) error {
+		for i, declared := range doc.Services {
+			if declared.Name == instance.Name && declared.Id == instance.Id {
+				doc.Services[i] = instance
+				return nil
+			}
+		}
+		doc.Services = append(doc.Services, instance)
+		return nil
+	})
+	return errors.Wrapf(err, "register service error[key=%s]", s.options.Id)
+}
+
+// Deregister removes the instance from the file
+func (s *Client) Deregister() error {
+	err := s.update(func(doc *Document) error {
+		for i, declared := range doc.Services {
+			if declared.Name == s.options.Name && declared.Id == s.options.Id {
+				doc.Services = append(doc.Services[:i], doc.Services[i+1:]...)
+				return nil
+			}
+		}
+		return discovery.ErrServiceNotFound
+	})
+	return errors.Wrapf(err, "deregister service error[key=%s]", s.options.Id)
+}
+
+// update applies fn to the content of the file and writes it back,
+// the file is locked for the clients of this process and, with flock, of the other processes
+func (s *Client) update(fn func(doc *Document) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	unlock, err := lockFile(s.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	doc, _, err := load(s.path)
+	if err != nil {
+		return err
+	}
+	if err = fn(doc); err != nil {
+		return err
+	}
+	return save(s.path, doc)
+}
@@ -0,0 +1,120 @@
+package file
+
+import (
+	"context"
+	"strings"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+	"github.com/pkg/errors"
+)
+
+var (
+	_ discovery.ContextKV  = (*Client)(nil)
+	_ discovery.PairSetter = (*Client)(nil)
+)
+
+func (s *Client) Get(key string) ([]byte, error) {
+	return s.GetContext(context.Background(), key)
+}
+
+func (s *Client) Set(key string, value string) error {
+	return s.SetContext(context.Background(), key, value)
+}
+
+func (s *Client) Delete(key string) error {
+	return s.DeleteContext(context.Background(), key)
+}
+
+func (s *Client) List(key string) (map[string][]byte, error) {
+	return s.ListContext(context.Background(), key)
+}
+
+func (s *Client) GetContext(ctx context.Context, key string) ([]byte, error) {
+	pair, err := s.GetPair(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return pair.Value, nil
+}
+
+// SetContext writes the key, its flags are dropped
+func (s *Client) SetContext(ctx context.Context, key string, value string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.update(func(doc *Document) error {
+		doc.setPair(key, []byte(value), 0)
+		return nil
+	})
+}
+
+func (s *Client) SetPair(ctx context.Context, pair *discovery.KVPair) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.update(func(doc *Document) error {
+		doc.setPair(pair.Key, pair.Value, pair.Flags)
+		return nil
+	})
+}
+
+func (s *Client) DeleteContext(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.update(func(doc *Document) error {
+		doc.deletePair(key)
+		return nil
+	})
+}
+
+func (s *Client) ListContext(ctx context.Context, key string) (map[string][]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	doc, _, err := load(s.path)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string][]byte)
+	for k, v := range doc.KV {
+		if strings.HasPrefix(k, key) {
+			values[k] = []byte(v)
+		}
+	}
+	if len(values) == 0 {
+		return nil, errors.Wrapf(discovery.ErrNotFound, "list kv error[prefix=%s]", key)
+	}
+	return values, nil
+}
+
+// GetPair returns the key with its flags, its modify index is a hash of the value and flags
+func (s *Client) GetPair(ctx context.Context, key string) (*discovery.KVPair, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	doc, _, err := load(s.path)
+	if err != nil {
+		return nil, err
+	}
+	pair, ok := doc.pair(key)
+	if !ok {
+		return nil, errors.Wrapf(discovery.ErrNotFound, "get kv error[key=%s]", key)
+	}
+	return pair, nil
+}
+
+func (s *Client) ListPairs(ctx context.Context, prefix string) ([]*discovery.KVPair, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	doc, _, err := load(s.path)
+	if err != nil {
+		return nil, err
+	}
+	pairs := doc.pairs(prefix, true)
+	if len(pairs) == 0 {
+		return nil, errors.Wrapf(discovery.ErrNotFound, "list kv error[prefix=%s]", prefix)
+	}
+	return pairs, nil
+}
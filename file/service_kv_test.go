@@ -0,0 +1,264 @@
+package file
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+	"github.com/pkg/errors"
+)
+
+func TestPair(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.yaml")
+	client := newTestClient(t, path, "a")
+	ctx := context.Background()
+
+	if err := client.SetPair(ctx, &discovery.KVPair{Key: "app/a", Value: []byte("1"), Flags: 7}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Set("app/b", "2"); err != nil {
+		t.Fatal(err)
+	}
+	pairs, err := newTestClient(t, path, "reader").ListPairs(ctx, "app/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pairs) != 2 || pairs[0].Key != "app/a" || pairs[0].Flags != 7 || pairs[1].Key != "app/b" || pairs[1].Flags != 0 {
+		t.Fatalf("ListPairs = %+v", pairs)
+	}
+	if pairs[0].ModifyIndex == 0 || pairs[0].ModifyIndex == pairs[1].ModifyIndex {
+		t.Fatalf("modify indexes %d and %d", pairs[0].ModifyIndex, pairs[1].ModifyIndex)
+	}
+
+	// Set drops the flags, as the other stores do
+	if err = client.SetContext(ctx, "app/a", "1"); err != nil {
+		t.Fatal(err)
+	}
+	pair, err := client.GetPair(ctx, "app/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pair.Flags != 0 || pair.ModifyIndex == pairs[0].ModifyIndex {
+		t.Fatalf("GetPair after Set = %+v", pair)
+	}
+
+	if err = client.DeleteContext(ctx, "app/a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.GetPair(ctx, "app/a"); !errors.Is(err, discovery.ErrNotFound) {
+		t.Fatalf("GetPair after Delete = %v, want %v", err, discovery.ErrNotFound)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err = client.SetContext(cancelled, "app/c", "3"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("SetContext with a cancelled context = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestCompareAndSet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.json")
+	client := newTestClient(t, path, "a")
+	ctx := context.Background()
+
+	if err := client.CompareAndSet(ctx, "k", "1", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CompareAndSet(ctx, "k", "2", 0); !errors.Is(err, discovery.ErrConflict) {
+		t.Fatalf("CompareAndSet of an existing key with 0 = %v, want %v", err, discovery.ErrConflict)
+	}
+	pair, err := client.GetPair(ctx, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an edit by hand changes the modify index
+	doc, _, err := load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc.KV["k"] = "edited"
+	if err = save(path, doc); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.CompareAndSet(ctx, "k", "2", pair.ModifyIndex); !errors.Is(err, discovery.ErrConflict) {
+		t.Fatalf("CompareAndSet after an edit = %v, want %v", err, discovery.ErrConflict)
+	}
+	if err = client.DeleteCAS(ctx, "k", pair.ModifyIndex); !errors.Is(err, discovery.ErrConflict) {
+		t.Fatalf("DeleteCAS after an edit = %v, want %v", err, discovery.ErrConflict)
+	}
+
+	if pair, err = client.GetPair(ctx, "k"); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.CompareAndSet(ctx, "k", "2", pair.ModifyIndex); err != nil {
+		t.Fatal(err)
+	}
+	if pair, err = client.GetPair(ctx, "k"); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.DeleteCAS(ctx, "k", pair.ModifyIndex); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.DeleteCAS(ctx, "k", pair.ModifyIndex); err != nil {
+		t.Fatalf("DeleteCAS of a missing key = %v", err)
+	}
+}
+
+func TestTxn(t *testing.T) {
+	client := newTestClient(t, filepath.Join(t.TempDir(), "registry.yaml"), "a")
+	ctx := context.Background()
+	if err := client.Set("a", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Set("b", "2"); err != nil {
+		t.Fatal(err)
+	}
+	pair, err := client.GetPair(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pairs, err := client.Txn(ctx, discovery.NewTxn().CheckIndex("a", pair.ModifyIndex).Get("b").Set("c", "3").Get("c").Delete("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pairs) != 2 || string(pairs[0].Value) != "2" || string(pairs[1].Value) != "3" {
+		t.Fatalf("Txn pairs = %+v, want b=2 and c=3", pairs)
+	}
+	if _, err := client.Get("a"); !errors.Is(err, discovery.ErrNotFound) {
+		t.Fatalf("Txn did not delete a: %v", err)
+	}
+
+	_, err = client.Txn(ctx, discovery.NewTxn().Set("d", "4").CheckIndex("b", pair.ModifyIndex))
+	if !errors.Is(err, discovery.ErrTxnAborted) {
+		t.Fatalf("Txn with a stale index = %v, want %v", err, discovery.ErrTxnAborted)
+	}
+	if _, err := client.Get("d"); !errors.Is(err, discovery.ErrNotFound) {
+		t.Fatalf("aborted Txn wrote d: %v", err)
+	}
+
+	// the flags of the check-and-set writes are kept
+	if _, err = client.Txn(ctx, discovery.NewTxn().CASPair(&discovery.KVPair{Key: "e", Value: []byte("5"), Flags: 2})); err != nil {
+		t.Fatal(err)
+	}
+	if pair, err = client.GetPair(ctx, "e"); err != nil || pair.Flags != 2 {
+		t.Fatalf("GetPair e = %+v, %v, want flags 2", pair, err)
+	}
+}
+
+func TestWatchKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.yaml")
+	client := newTestClient(t, path, "a")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	updates, err := client.WatchKey(ctx, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := func() discovery.KVUpdate {
+		t.Helper()
+		select {
+		case u := <-updates:
+			return u
+		case <-time.After(2 * time.Second):
+			t.Fatal("no update")
+		}
+		return discovery.KVUpdate{}
+	}
+	if u := next(); u.Key != "k" || !u.Deleted {
+		t.Fatalf("first update = %+v, want a deleted k", u)
+	}
+	if err = client.Set("k", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if u := next(); u.Deleted || string(u.Value) != "1" {
+		t.Fatalf("update = %+v, want k=1", u)
+	}
+	// the other keys are not sent
+	if err = client.Set("other", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.Delete("k"); err != nil {
+		t.Fatal(err)
+	}
+	if u := next(); u.Key != "k" || !u.Deleted {
+		t.Fatalf("update = %+v, want a deleted k", u)
+	}
+
+	cancel()
+	for range updates {
+	}
+}
+
+func TestWatchPrefix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.yaml")
+	client := newTestClient(t, path, "a")
+	if err := client.Set("app/a", "1"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	updates, err := client.WatchPrefix(ctx, "app/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := func() discovery.KVUpdate {
+		t.Helper()
+		select {
+		case u := <-updates:
+			return u
+		case <-time.After(2 * time.Second):
+			t.Fatal("no update")
+		}
+		return discovery.KVUpdate{}
+	}
+	if u := next(); u.Key != "app/a" || string(u.Value) != "1" {
+		t.Fatalf("first update = %+v, want app/a=1", u)
+	}
+	// an edit by hand is seen
+	if err = os.WriteFile(path, []byte("kv:\n  app/b: \"2\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if u := next(); u.Key != "app/b" || string(u.Value) != "2" {
+		t.Fatalf("update = %+v, want app/b=2", u)
+	}
+	if u := next(); u.Key != "app/a" || !u.Deleted {
+		t.Fatalf("update = %+v, want a deleted app/a", u)
+	}
+}
+
+func TestUpdateLocksFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.yaml")
+	client := newTestClient(t, path, "a")
+
+	// the lock of another process
+	unlock, err := lockFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- client.Set("k", "1")
+	}()
+	select {
+	case err = <-done:
+		unlock()
+		t.Fatalf("Set returned %v while the file is locked", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Set still blocked after the unlock")
+	}
+}
@@ -0,0 +1,61 @@
+package file
+
+import (
+	"context"
+	"sort"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+	"github.com/pkg/errors"
+)
+
+var _ discovery.Resolver = (*Client)(nil)
+
+// GetService returns the instances of a service grouped by version
+func (s *Client) GetService(ctx context.Context, name string, filters ...discovery.Filter) ([]*discovery.Service, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	o := discovery.NewFilterOptions(filters...)
+	doc, _, err := load(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes []discovery.ServiceInstance
+	for _, node := range sortedNodes(doc.services()[name]) {
+		if o.PassingOnly && !node.IsHealthy() {
+			continue
+		}
+		if !discovery.HasTags(node.GetTags(), o.Tags) {
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	if len(nodes) == 0 {
+		return nil, errors.Wrapf(discovery.ErrServiceNotFound, "get service error[name=%s]", name)
+	}
+	return discovery.GroupByVersion(name, nodes), nil
+}
+
+// ListServices returns the declared services
+func (s *Client) ListServices(ctx context.Context) ([]*discovery.Service, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	doc, _, err := load(s.path)
+	if err != nil {
+		return nil, err
+	}
+	services := doc.services()
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make([]*discovery.Service, 0, len(names))
+	for _, name := range names {
+		result = append(result, &discovery.Service{Name: name})
+	}
+	return result, nil
+}
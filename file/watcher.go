@@ -0,0 +1,209 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+	"github.com/donetkit/contrib_discovery/watcher"
+	"github.com/pkg/errors"
+)
+
+// PollTime is the interval at which watchers read the registry file
+var PollTime = time.Second
+
+var _ watcher.EventWatcher = (*Watcher)(nil)
+
+// Watcher emits the same create/update/delete results as the consul watcher when the file changes on disk.
+// WatchOptions.Filter, a Consul expression, is not supported and fails Watch.
+type Watcher struct {
+	path     string
+	option   watcher.WatchOptions
+	queue    *watcher.Queue
+	stopOnce sync.Once
+
+	// index counts the changes of the file, it is the Id of the events
+	index    uint64
+	raw      []byte
+	services map[string]map[string]*discovery.DefaultServiceInstance
+}
+
+// Watch returns a watcher of the file, it is stopped when ctx (or WatchOptions.Context, if set) is done
+func (s *Client) Watch(ctx context.Context, opts ...watcher.WatchOption) (watcher.EventWatcher, error) {
+	w, err := newWatcher(s.path, append([]watcher.WatchOption{watcher.WatchContext(ctx)}, opts...)...)
+	if err != nil {
+		// a nil *Watcher would be a non-nil watcher.EventWatcher
+		return nil, err
+	}
+	return w, nil
+}
+
+func newWatcher(path string, opts ...watcher.WatchOption) (*Watcher, error) {
+	var wo watcher.WatchOptions
+	for _, o := range opts {
+		o(&wo)
+	}
+	if wo.Filter != "" {
+		return nil, errors.Errorf("file registry does not support watch filters[filter=%s]", wo.Filter)
+	}
+	if wo.Context == nil {
+		wo.Context = context.Background()
+	}
+
+	w := &Watcher{
+		path:     path,
+		option:   wo,
+		queue:    watcher.NewQueue(),
+		services: make(map[string]map[string]*discovery.DefaultServiceInstance),
+	}
+	// the current services are the first events
+	if err := w.poll(); err != nil {
+		return nil, err
+	}
+	go w.run()
+
+	go func() {
+		select {
+		case <-wo.Context.Done():
+			w.Stop()
+		case <-w.queue.Done():
+		}
+	}()
+	return w, nil
+}
+
+// run polls the file until the watcher is stopped, a file that cannot be read keeps the last services
+func (w *Watcher) run() {
+	ticker := time.NewTicker(PollTime)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.queue.Done():
+			return
+		case <-ticker.C:
+			_ = w.poll()
+		}
+	}
+}
+
+// poll reads the file and queues the events of the services changed since the last read
+func (w *Watcher) poll() error {
+	doc, raw, err := load(w.path)
+	if err != nil {
+		return err
+	}
+	if w.index > 0 && bytes.Equal(raw, w.raw) {
+		return nil
+	}
+	w.index++
+	w.raw = raw
+
+	current := doc.services()
+	var names []string
+	for name := range current {
+		names = append(names, name)
+	}
+	for name := range w.services {
+		if _, ok := current[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		w.changed(w.index, name, sortedNodes(w.services[name]), sortedNodes(current[name]))
+	}
+	w.services = current
+	return nil
+}
+
+func (w *Watcher) Next() (*watcher.Result, error) {
+	return w.queue.Next()
+}
+
+// Events returns the typed events of the watcher, with the change count of the file as Id.
+// Events and Next consume the same stream, use one of them.
+// The channel is closed when the watcher is stopped.
+func (w *Watcher) Events() <-chan watcher.Event {
+	return w.queue.Events()
+}
+
+func (w *Watcher) Stop() {
+	w.stopOnce.Do(func() {
+		w.queue.Close()
+	})
+}
+
+// changed queues the events for the nodes of a service changing from before to after
+func (w *Watcher) changed(idx uint64, name string, before, after []discovery.ServiceInstance) {
+	if len(w.option.Service) > 0 && name != w.option.Service {
+		return
+	}
+	before, after = w.option.Select(before), w.option.Select(after)
+	if sameNodes(before, after) {
+		return
+	}
+	w.queue.Push(watcher.Diff(idx, name, before, after)...)
+}
+
+// sameNodes reports whether the nodes of a service are unchanged, the file is rewritten on every write
+// so unrelated edits must not produce updates
+func sameNodes(old, nodes []discovery.ServiceInstance) bool {
+	if len(old) != len(nodes) {
+		return false
+	}
+	for i := range old {
+		a, b := old[i].(*discovery.DefaultServiceInstance), nodes[i].(*discovery.DefaultServiceInstance)
+		if a.Id != b.Id || a.Host != b.Host || a.Port != b.Port || a.Weight != b.Weight ||
+			a.Enable != b.Enable || a.ClusterName != b.ClusterName || a.GroupName != b.GroupName ||
+			!equalStrings(a.Tags, b.Tags) || !equalMetadata(a.Metadata, b.Metadata) {
+			return false
+		}
+	}
+	return true
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalMetadata(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// sortedNodes returns copies of the instances sorted by id
+func sortedNodes(instances map[string]*discovery.DefaultServiceInstance) []discovery.ServiceInstance {
+	if len(instances) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(instances))
+	for id := range instances {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	result := make([]discovery.ServiceInstance, 0, len(ids))
+	for _, id := range ids {
+		n := new(discovery.DefaultServiceInstance)
+		*n = *instances[id]
+		result = append(result, n)
+	}
+	return result
+}
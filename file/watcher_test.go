@@ -0,0 +1,96 @@
+package file
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/donetkit/contrib_discovery/watcher"
+)
+
+func init() {
+	PollTime = 10 * time.Millisecond
+}
+
+func expectEvent(t *testing.T, events <-chan watcher.Event, typ watcher.EventType, version string, nodes int) {
+	t.Helper()
+	var e watcher.Event
+	select {
+	case e = <-events:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("no event, want %s svc@%s", typ, version)
+	}
+	if e.Type != typ || e.Service.Name != "svc" || e.Service.Version != version || len(e.Service.Nodes) != nodes {
+		t.Fatalf("event = %s %s@%s with %d nodes, want %s svc@%s with %d nodes",
+			e.Type, e.Service.Name, e.Service.Version, len(e.Service.Nodes), typ, version, nodes)
+	}
+}
+
+func expectNoEvent(t *testing.T, events <-chan watcher.Event) {
+	t.Helper()
+	select {
+	case e := <-events:
+		t.Fatalf("unexpected event %s %s@%s", e.Type, e.Service.Name, e.Service.Version)
+	case <-time.After(10 * PollTime):
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.yaml")
+	a := newTestClient(t, path, "a")
+	if err := a.Register(); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := a.Watch(context.Background(), watcher.WatchService("svc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+	events := w.Events()
+	expectEvent(t, events, watcher.Create, "", 0)
+	expectEvent(t, events, watcher.Create, "1.0.0", 1)
+
+	b := newTestClient(t, path, "b")
+	if err := b.Register(); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, events, watcher.Update, "1.0.0", 2)
+
+	// rewriting the file without changing the instances sends nothing
+	if err := a.Set("k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	expectNoEvent(t, events)
+
+	if err := a.Deregister(); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, events, watcher.Delete, "1.0.0", 1)
+	expectEvent(t, events, watcher.Update, "1.0.0", 1)
+
+	// a broken file keeps the last services
+	if err := os.WriteFile(path, []byte("services: ["), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expectNoEvent(t, events)
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, events, watcher.Delete, "1.0.0", 1)
+	expectEvent(t, events, watcher.Delete, "", 0)
+}
+
+func TestWatcherFilter(t *testing.T) {
+	client := newTestClient(t, filepath.Join(t.TempDir(), "registry.yaml"), "a")
+	w, err := client.Watch(context.Background(), watcher.WatchFilter(`Service.Meta.env == "prod"`))
+	if err == nil {
+		t.Fatal("Watch with a filter succeeded")
+	}
+	if w != nil {
+		t.Fatalf("Watch with a filter returned the watcher %#v", w)
+	}
+}
@@ -0,0 +1,193 @@
+package kvbackup
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+	"github.com/pkg/errors"
+)
+
+// ChangeType is the write restoring a backup applies to a key
+type ChangeType int
+
+const (
+	// Create is a key of the backup missing from the store
+	Create ChangeType = iota
+	// Update is a key whose value or flags differ
+	Update
+	// Delete is a key of the store missing from the backup
+	Delete
+)
+
+func (t ChangeType) String() string {
+	switch t {
+	case Create:
+		return "create"
+	case Update:
+		return "update"
+	case Delete:
+		return "delete"
+	default:
+		return "unknown"
+	}
+}
+
+// Change between a backup and the store, Backup or Live is nil when the key is missing from it
+type Change struct {
+	Type   ChangeType
+	Key    string
+	Backup *Entry
+	Live   *Entry
+}
+
+// String returns the change as a diff line
+func (c Change) String() string {
+	switch c.Type {
+	case Create:
+		return fmt.Sprintf("+ %s = %q (flags %d)", c.Key, c.Backup.Value, c.Backup.Flags)
+	case Update:
+		return fmt.Sprintf("~ %s = %q (flags %d) -> %q (flags %d)", c.Key, c.Live.Value, c.Live.Flags, c.Backup.Value, c.Backup.Flags)
+	default:
+		return fmt.Sprintf("- %s = %q (flags %d)", c.Key, c.Live.Value, c.Live.Flags)
+	}
+}
+
+// Export returns the keys under the prefix with their flags
+func Export(ctx context.Context, kv discovery.ContextKV, prefix string) ([]*Entry, error) {
+	pairs, err := kv.ListPairs(ctx, prefix)
+	if err != nil && !errors.Is(err, discovery.ErrNotFound) {
+		return nil, errors.Wrapf(err, "export kv error[prefix=%s]", prefix)
+	}
+	entries := make([]*Entry, 0, len(pairs))
+	for _, p := range pairs {
+		entries = append(entries, &Entry{Key: p.Key, Flags: p.Flags, Value: p.Value})
+	}
+	return sorted(entries), nil
+}
+
+// Diff compares the backup entries under the prefix with the keys under the prefix, sorted by key.
+// The flags are only compared when the store is a discovery.PairSetter.
+func Diff(ctx context.Context, kv discovery.ContextKV, entries []*Entry, prefix string) ([]Change, error) {
+	live, err := Export(ctx, kv, prefix)
+	if err != nil {
+		return nil, err
+	}
+	return diff(kv, underPrefix(entries, prefix), live), nil
+}
+
+// Restore writes the backup to the store according to the mode and returns the applied changes,
+// the keys already matching the backup are not written. With a prefix only the entries under it are restored,
+// without one only the keys of the backup are read from the store.
+// Stores that are not a discovery.PairSetter are written without the flags of the backup.
+func Restore(ctx context.Context, kv discovery.ContextKV, entries []*Entry, opts ...Option) ([]Change, error) {
+	var o Options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.Mode == Prune && o.Prefix == "" {
+		return nil, errors.New("prune restore needs a prefix")
+	}
+
+	entries = underPrefix(entries, o.Prefix)
+	var live []*Entry
+	var err error
+	if o.Prefix == "" {
+		live, err = lookup(ctx, kv, entries)
+	} else {
+		live, err = Export(ctx, kv, o.Prefix)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	setter, hasFlags := kv.(discovery.PairSetter)
+	var applied []Change
+	for _, c := range diff(kv, entries, live) {
+		switch {
+		case c.Type == Update && o.Mode == SkipExisting:
+			continue
+		case c.Type == Delete && o.Mode != Prune:
+			continue
+		}
+		if !o.DryRun {
+			switch {
+			case c.Type == Delete:
+				err = kv.DeleteContext(ctx, c.Key)
+			case hasFlags:
+				err = setter.SetPair(ctx, &discovery.KVPair{Key: c.Key, Value: c.Backup.Value, Flags: c.Backup.Flags})
+			default:
+				err = kv.SetContext(ctx, c.Key, string(c.Backup.Value))
+			}
+			if err != nil {
+				return applied, errors.Wrapf(err, "restore kv error[key=%s]", c.Key)
+			}
+		}
+		applied = append(applied, c)
+	}
+	return applied, nil
+}
+
+// diff compares the backup entries with the live entries, sorted by key
+func diff(kv discovery.ContextKV, entries []*Entry, live []*Entry) []Change {
+	_, hasFlags := kv.(discovery.PairSetter)
+	liveKeys := make(map[string]*Entry, len(live))
+	for _, e := range live {
+		liveKeys[e.Key] = e
+	}
+	backupKeys := make(map[string]*Entry, len(entries))
+	for _, e := range entries {
+		backupKeys[e.Key] = e
+	}
+
+	var changes []Change
+	for _, b := range entries {
+		l, ok := liveKeys[b.Key]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Type: Create, Key: b.Key, Backup: b})
+		case !bytes.Equal(l.Value, b.Value) || (hasFlags && l.Flags != b.Flags):
+			changes = append(changes, Change{Type: Update, Key: b.Key, Backup: b, Live: l})
+		}
+	}
+	for _, l := range live {
+		if _, ok := backupKeys[l.Key]; !ok {
+			changes = append(changes, Change{Type: Delete, Key: l.Key, Live: l})
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes
+}
+
+// lookup reads the keys of the entries from the store
+func lookup(ctx context.Context, kv discovery.ContextKV, entries []*Entry) ([]*Entry, error) {
+	var live []*Entry
+	for _, e := range entries {
+		p, err := kv.GetPair(ctx, e.Key)
+		if errors.Is(err, discovery.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "restore kv error[key=%s]", e.Key)
+		}
+		live = append(live, &Entry{Key: p.Key, Flags: p.Flags, Value: p.Value})
+	}
+	return live, nil
+}
+
+// underPrefix returns the entries whose key starts with the prefix
+func underPrefix(entries []*Entry, prefix string) []*Entry {
+	if prefix == "" {
+		return entries
+	}
+	var matched []*Entry
+	for _, e := range entries {
+		if strings.HasPrefix(e.Key, prefix) {
+			matched = append(matched, e)
+		}
+	}
+	return matched
+}
@@ -0,0 +1,118 @@
+package kvbackup
+
+import (
+	"context"
+	"testing"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+	"github.com/donetkit/contrib_discovery/memory"
+)
+
+// valueKV hides the SetPair method of a store
+type valueKV struct {
+	discovery.ContextKV
+}
+
+func newStore(t *testing.T, values map[string]string) *memory.Client {
+	t.Helper()
+	client, err := memory.NewWithRegistry(memory.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range values {
+		if err := client.Set(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return client
+}
+
+func changeKeys(changes []Change) []string {
+	var keys []string
+	for _, c := range changes {
+		keys = append(keys, c.Type.String()+" "+c.Key)
+	}
+	return keys
+}
+
+func expectChanges(t *testing.T, changes []Change, want ...string) {
+	t.Helper()
+	got := changeKeys(changes)
+	if len(got) != len(want) {
+		t.Fatalf("changes = %v, want %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("changes = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestRestorePrefix(t *testing.T) {
+	ctx := context.Background()
+	store := newStore(t, map[string]string{"app/a": "old", "app/stale": "1", "other/x": "1"})
+	entries := []*Entry{
+		{Key: "app/a", Value: []byte("new")},
+		{Key: "app/b", Value: []byte("b")},
+		{Key: "other/y", Value: []byte("y")},
+	}
+
+	changes, err := Restore(ctx, store, entries, WithMode(Prune), WithPrefix("app/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectChanges(t, changes, "update app/a", "create app/b", "delete app/stale")
+	if _, err := store.Get("other/y"); err == nil {
+		t.Fatal("an entry outside the prefix was restored")
+	}
+	if _, err := store.Get("other/x"); err != nil {
+		t.Fatal("a key outside the prefix was deleted")
+	}
+}
+
+func TestRestoreBackupKeys(t *testing.T) {
+	ctx := context.Background()
+	store := newStore(t, map[string]string{"a": "1", "b": "old", "c": "unrelated"})
+	entries := []*Entry{
+		{Key: "a", Value: []byte("1")},
+		{Key: "b", Value: []byte("new")},
+		{Key: "d", Value: []byte("d"), Flags: 7},
+	}
+
+	changes, err := Restore(ctx, store, entries, WithDryRun())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectChanges(t, changes, "update b", "create d")
+
+	if _, err = Restore(ctx, store, entries); err != nil {
+		t.Fatal(err)
+	}
+	pair, err := store.GetPair(ctx, "d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(pair.Value) != "d" || pair.Flags != 7 {
+		t.Fatalf("restored d = %q flags %d, want d flags 7", pair.Value, pair.Flags)
+	}
+}
+
+func TestRestoreWithoutFlags(t *testing.T) {
+	ctx := context.Background()
+	store := newStore(t, map[string]string{"a": "1"})
+	entries := []*Entry{{Key: "a", Value: []byte("1"), Flags: 3}, {Key: "b", Value: []byte("2"), Flags: 3}}
+
+	// the flags of a store without SetPair are neither compared nor written
+	changes, err := Restore(ctx, valueKV{store}, entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectChanges(t, changes, "create b")
+	pair, err := store.GetPair(ctx, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(pair.Value) != "2" || pair.Flags != 0 {
+		t.Fatalf("restored b = %q flags %d, want 2 flags 0", pair.Value, pair.Flags)
+	}
+}
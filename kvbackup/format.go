@@ -0,0 +1,149 @@
+package kvbackup
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Format of a backup file
+type Format int
+
+const (
+	// JSON is an array of {"key", "flags", "value"} objects with base64 values, as written by consul kv export
+	JSON Format = iota
+	// Tar is a tar archive with a file per key, the flags are kept in a PAX record
+	Tar
+)
+
+// paxFlags is the PAX record holding the flags of a key in Tar backups
+const paxFlags = "DISCOVERY.flags"
+
+// Entry is a backed up key
+type Entry struct {
+	Key   string `json:"key"`
+	Flags uint64 `json:"flags"`
+	Value []byte `json:"value"`
+}
+
+// Encode writes the entries in the format, sorted by key
+func Encode(w io.Writer, entries []*Entry, format Format) error {
+	entries = sorted(entries)
+	switch format {
+	case JSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		if entries == nil {
+			entries = []*Entry{}
+		}
+		for i, e := range entries {
+			if e.Value == nil {
+				// consul kv import expects a string
+				entries[i] = &Entry{Key: e.Key, Flags: e.Flags, Value: []byte{}}
+			}
+		}
+		return errors.Wrap(enc.Encode(entries), "encode json backup error")
+	case Tar:
+		return encodeTar(w, entries)
+	default:
+		return errors.Errorf("unknown backup format %d", format)
+	}
+}
+
+// Decode reads the entries of a backup in the format
+func Decode(r io.Reader, format Format) ([]*Entry, error) {
+	switch format {
+	case JSON:
+		var entries []*Entry
+		if err := json.NewDecoder(r).Decode(&entries); err != nil {
+			return nil, errors.Wrap(err, "decode json backup error")
+		}
+		return entries, nil
+	case Tar:
+		return decodeTar(r)
+	default:
+		return nil, errors.Errorf("unknown backup format %d", format)
+	}
+}
+
+// encodeTar writes a file per key, keys ending with / are folders
+func encodeTar(w io.Writer, entries []*Entry) error {
+	tw := tar.NewWriter(w)
+	now := time.Now()
+	for _, e := range entries {
+		hdr := &tar.Header{
+			Name:       e.Key,
+			Mode:       0644,
+			Size:       int64(len(e.Value)),
+			ModTime:    now,
+			Typeflag:   tar.TypeReg,
+			Format:     tar.FormatPAX,
+			PAXRecords: map[string]string{paxFlags: strconv.FormatUint(e.Flags, 10)},
+		}
+		if strings.HasSuffix(e.Key, "/") {
+			// a folder cannot hold data in a tar, its value is dropped
+			hdr.Typeflag, hdr.Mode, hdr.Size = tar.TypeDir, 0755, 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return errors.Wrapf(err, "write tar backup error[key=%s]", e.Key)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			if _, err := tw.Write(e.Value); err != nil {
+				return errors.Wrapf(err, "write tar backup error[key=%s]", e.Key)
+			}
+		}
+	}
+	return errors.Wrap(tw.Close(), "write tar backup error")
+}
+
+// decodeTar reads a file per key, directories are keys only when they carry the flags record,
+// so an archive of a directory tree made with tar can be restored too
+func decodeTar(r io.Reader) ([]*Entry, error) {
+	tr := tar.NewReader(r)
+	var entries []*Entry
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "read tar backup error")
+		}
+		name := strings.TrimPrefix(hdr.Name, "./")
+		flagsRecord, hasFlags := hdr.PAXRecords[paxFlags]
+		var flags uint64
+		if hasFlags {
+			if flags, err = strconv.ParseUint(flagsRecord, 10, 64); err != nil {
+				return nil, errors.Wrapf(err, "invalid flags in tar backup[key=%s]", name)
+			}
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeReg:
+			value, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, errors.Wrapf(err, "read tar backup error[key=%s]", name)
+			}
+			entries = append(entries, &Entry{Key: name, Flags: flags, Value: value})
+		case tar.TypeDir:
+			if hasFlags {
+				if !strings.HasSuffix(name, "/") {
+					name += "/"
+				}
+				entries = append(entries, &Entry{Key: name, Flags: flags})
+			}
+		}
+	}
+}
+
+func sorted(entries []*Entry) []*Entry {
+	s := append([]*Entry(nil), entries...)
+	sort.Slice(s, func(i, j int) bool { return s[i].Key < s[j].Key })
+	return s
+}
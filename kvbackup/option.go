@@ -0,0 +1,46 @@
+package kvbackup
+
+// Mode of a restore
+type Mode int
+
+const (
+	// Overwrite writes every key of the backup
+	Overwrite Mode = iota
+	// SkipExisting only writes the keys missing from the store
+	SkipExisting
+	// Prune writes every key of the backup and deletes the keys under the prefix missing from the backup
+	Prune
+)
+
+// Options for restores
+type Options struct {
+	Mode Mode
+	// Prefix limits the restore to the entries and keys under it, it is required for Prune
+	Prefix string
+	// DryRun returns the changes without writing the store
+	DryRun bool
+}
+
+// Option for restores
+type Option func(*Options)
+
+// WithMode set restore mode function
+func WithMode(mode Mode) Option {
+	return func(o *Options) {
+		o.Mode = mode
+	}
+}
+
+// WithPrefix set prefix function
+func WithPrefix(prefix string) Option {
+	return func(o *Options) {
+		o.Prefix = prefix
+	}
+}
+
+// WithDryRun set dry run function
+func WithDryRun() Option {
+	return func(o *Options) {
+		o.DryRun = true
+	}
+}
@@ -0,0 +1,83 @@
+package kvsync
+
+// Options for the syncer
+type Options struct {
+	// Prefix of the mirrored keys, all keys when blank
+	Prefix string
+	// Include patterns, a key is mirrored when it matches one of them, all keys when empty
+	Include []string
+	// Exclude patterns, a key matching one of them is never mirrored
+	Exclude []string
+	// DryRun computes the changes without writing the targets
+	DryRun bool
+	// Delete removes the target keys missing from the source
+	Delete bool
+	// Force overwrites the target keys changed since the last sync instead of reporting a conflict
+	Force bool
+	// OnReport is called with the report of every target after each sync of Run
+	OnReport func(*Report)
+	// StateFile keeps the modify indexes of the target keys after the last sync,
+	// so the changes made on the targets between two runs are reported as conflicts.
+	// The indexes are kept in memory only when blank.
+	StateFile string
+}
+
+// Option for syncer
+type Option func(*Options)
+
+// WithPrefix set mirrored prefix function
+func WithPrefix(prefix string) Option {
+	return func(o *Options) {
+		o.Prefix = prefix
+	}
+}
+
+// WithInclude set include patterns function, patterns use path.Match syntax on the key relative to the prefix,
+// a pattern ending with / matches every key of the folder
+func WithInclude(patterns ...string) Option {
+	return func(o *Options) {
+		o.Include = append(o.Include, patterns...)
+	}
+}
+
+// WithExclude set exclude patterns function, see WithInclude for the syntax
+func WithExclude(patterns ...string) Option {
+	return func(o *Options) {
+		o.Exclude = append(o.Exclude, patterns...)
+	}
+}
+
+// WithDryRun set dry run function
+func WithDryRun() Option {
+	return func(o *Options) {
+		o.DryRun = true
+	}
+}
+
+// WithDelete set delete propagation function
+func WithDelete() Option {
+	return func(o *Options) {
+		o.Delete = true
+	}
+}
+
+// WithForce set overwrite conflicts function
+func WithForce() Option {
+	return func(o *Options) {
+		o.Force = true
+	}
+}
+
+// WithOnReport set report callback function
+func WithOnReport(fn func(*Report)) Option {
+	return func(o *Options) {
+		o.OnReport = fn
+	}
+}
+
+// WithStateFile set sync state file function
+func WithStateFile(path string) Option {
+	return func(o *Options) {
+		o.StateFile = path
+	}
+}
@@ -0,0 +1,96 @@
+package kvsync
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ChangeType is the write applied to a target key
+type ChangeType int
+
+const (
+	Create ChangeType = iota
+	Update
+	Delete
+)
+
+func (t ChangeType) String() string {
+	switch t {
+	case Create:
+		return "create"
+	case Update:
+		return "update"
+	case Delete:
+		return "delete"
+	default:
+		return "unknown"
+	}
+}
+
+// Change of a target key, Value and Flags are the source ones, OldValue and OldFlags the target ones
+type Change struct {
+	Type     ChangeType
+	Key      string
+	Value    []byte
+	OldValue []byte
+	Flags    uint64
+	OldFlags uint64
+}
+
+// String returns the change as a diff line
+func (c Change) String() string {
+	switch c.Type {
+	case Create:
+		return fmt.Sprintf("+ %s = %q", c.Key, c.Value)
+	case Update:
+		if c.Flags != c.OldFlags {
+			return fmt.Sprintf("~ %s = %q -> %q (flags %d -> %d)", c.Key, c.OldValue, c.Value, c.OldFlags, c.Flags)
+		}
+		return fmt.Sprintf("~ %s = %q -> %q", c.Key, c.OldValue, c.Value)
+	default:
+		return fmt.Sprintf("- %s = %q", c.Key, c.OldValue)
+	}
+}
+
+// Conflict is a target key that was not written
+type Conflict struct {
+	Key    string
+	Reason string
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("! %s: %s", c.Key, c.Reason)
+}
+
+// Report is the outcome of the sync of a target
+type Report struct {
+	Target string
+	DryRun bool
+	// Changes applied, or to apply for a dry run
+	Changes   []Change
+	Conflicts []Conflict
+	// Err is set when the sync of the target failed
+	Err error
+}
+
+// String returns the changes and conflicts as a diff
+func (r *Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "target %s", r.Target)
+	if r.DryRun {
+		b.WriteString(" (dry run)")
+	}
+	fmt.Fprintf(&b, ": %d changes, %d conflicts\n", len(r.Changes), len(r.Conflicts))
+	for _, c := range r.Changes {
+		b.WriteString(c.String())
+		b.WriteByte('\n')
+	}
+	for _, c := range r.Conflicts {
+		b.WriteString(c.String())
+		b.WriteByte('\n')
+	}
+	if r.Err != nil {
+		fmt.Fprintf(&b, "error: %v\n", r.Err)
+	}
+	return b.String()
+}
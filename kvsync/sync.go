@@ -0,0 +1,346 @@
+package kvsync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+	"github.com/pkg/errors"
+)
+
+// Store is a KV the syncer reads and writes, writes are check-and-set so concurrent target writes are not lost.
+// The flags of the keys are mirrored to the stores implementing discovery.PairSetter.
+type Store interface {
+	discovery.ContextKV
+	discovery.TxnKV
+}
+
+// Target is a store the source is mirrored to
+type Target struct {
+	Name string
+	KV   Store
+}
+
+// Syncer mirrors a prefix of a source KV to targets
+type Syncer struct {
+	source  discovery.ContextKV
+	targets []Target
+	options Options
+
+	mu sync.Mutex
+	// synced are the modify indexes of the target keys after the last sync, keyed by target name
+	synced map[string]map[string]uint64
+}
+
+// New returns a syncer of the source to the targets
+func New(source discovery.ContextKV, targets []Target, opts ...Option) (*Syncer, error) {
+	var o Options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	for _, p := range append(append([]string(nil), o.Include...), o.Exclude...) {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, errors.Wrapf(err, "invalid pattern %q", p)
+		}
+	}
+	synced, err := loadState(o.StateFile)
+	if err != nil {
+		return nil, err
+	}
+	return &Syncer{
+		source:  source,
+		targets: targets,
+		options: o,
+		synced:  synced,
+	}, nil
+}
+
+// loadState reads the sync state file, a missing file is an empty state
+func loadState(file string) (map[string]map[string]uint64, error) {
+	synced := make(map[string]map[string]uint64)
+	if file == "" {
+		return synced, nil
+	}
+	buff, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return synced, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "load sync state error[path=%s]", file)
+	}
+	if err = json.Unmarshal(buff, &synced); err != nil {
+		return nil, errors.Wrapf(err, "load sync state error[path=%s]", file)
+	}
+	return synced, nil
+}
+
+// saveState writes the sync state file with a temp file and a rename
+func (s *Syncer) saveState() error {
+	file := s.options.StateFile
+	if file == "" || s.options.DryRun {
+		return nil
+	}
+	buff, err := json.MarshalIndent(s.synced, "", "\t")
+	if err != nil {
+		return errors.Wrapf(err, "save sync state error[path=%s]", file)
+	}
+	tmp := file + ".tmp"
+	if err = os.WriteFile(tmp, buff, 0o644); err == nil {
+		err = os.Rename(tmp, file)
+	}
+	return errors.Wrapf(err, "save sync state error[path=%s]", file)
+}
+
+// Sync mirrors the source to every target once, it returns a report per target in order.
+// The returned error is the first failure, the other targets are still synced.
+func (s *Syncer) Sync(ctx context.Context) ([]*Report, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reports := make([]*Report, 0, len(s.targets))
+	source, err := s.list(ctx, s.source)
+	if err != nil {
+		err = errors.Wrap(err, "list source error")
+		for _, t := range s.targets {
+			reports = append(reports, &Report{Target: t.Name, DryRun: s.options.DryRun, Err: err})
+		}
+		return reports, err
+	}
+
+	var first error
+	for _, t := range s.targets {
+		report := s.syncTarget(ctx, t, source)
+		if report.Err != nil && first == nil {
+			first = errors.Wrapf(report.Err, "sync target error[target=%s]", t.Name)
+		}
+		reports = append(reports, report)
+	}
+	if err = s.saveState(); err != nil && first == nil {
+		first = err
+	}
+	return reports, first
+}
+
+// Run syncs the targets, then syncs them again on every change of the source until ctx is done.
+// The source must implement discovery.KVWatcher, the reports are passed to Options.OnReport.
+func (s *Syncer) Run(ctx context.Context) error {
+	w, ok := s.source.(discovery.KVWatcher)
+	if !ok {
+		return errors.New("source does not support watch")
+	}
+	// watch first so no change is missed, the first updates are the current values
+	updates, err := w.WatchPrefix(ctx, s.options.Prefix)
+	if err != nil {
+		return errors.Wrapf(err, "watch source error[prefix=%s]", s.options.Prefix)
+	}
+
+	s.report(ctx)
+	for range updates {
+		// coalesce the updates of one change
+		for drained := false; !drained; {
+			select {
+			case _, ok := <-updates:
+				if !ok {
+					return ctx.Err()
+				}
+			default:
+				drained = true
+			}
+		}
+		s.report(ctx)
+	}
+	return ctx.Err()
+}
+
+func (s *Syncer) report(ctx context.Context) {
+	reports, _ := s.Sync(ctx)
+	if s.options.OnReport == nil || ctx.Err() != nil {
+		return
+	}
+	for _, r := range reports {
+		s.options.OnReport(r)
+	}
+}
+
+func (s *Syncer) syncTarget(ctx context.Context, t Target, source map[string]*discovery.KVPair) *Report {
+	report := &Report{Target: t.Name, DryRun: s.options.DryRun}
+	target, err := s.list(ctx, t.KV)
+	if err != nil {
+		report.Err = errors.Wrap(err, "list target error")
+		return report
+	}
+	synced, ok := s.synced[t.Name]
+	if !ok {
+		synced = make(map[string]uint64)
+		s.synced[t.Name] = synced
+	}
+	dryRun := s.options.DryRun
+	_, flags := t.KV.(discovery.PairSetter)
+
+	for _, key := range sortedKeys(source) {
+		sp, dp := source[key], target[key]
+		if dp != nil && bytes.Equal(sp.Value, dp.Value) && (!flags || sp.Flags == dp.Flags) {
+			if !dryRun {
+				synced[key] = dp.ModifyIndex
+			}
+			continue
+		}
+		if reason := s.conflict(synced, key, dp); reason != "" {
+			report.Conflicts = append(report.Conflicts, Conflict{Key: key, Reason: reason})
+			continue
+		}
+
+		change := Change{Type: Create, Key: key, Value: sp.Value}
+		var index uint64
+		if dp != nil {
+			change.Type, change.OldValue, index = Update, dp.Value, dp.ModifyIndex
+		}
+		if flags {
+			change.Flags = sp.Flags
+			if dp != nil {
+				change.OldFlags = dp.Flags
+			}
+		}
+		if !dryRun {
+			if err = write(ctx, t.KV, flags, sp, index); err != nil {
+				if errors.Is(err, discovery.ErrConflict) {
+					report.Conflicts = append(report.Conflicts, Conflict{Key: key, Reason: "changed on target during sync"})
+					continue
+				}
+				report.Err = err
+				return report
+			}
+			pair, err := t.KV.GetPair(ctx, key)
+			if err != nil {
+				report.Err = err
+				return report
+			}
+			synced[key] = pair.ModifyIndex
+		}
+		report.Changes = append(report.Changes, change)
+	}
+
+	for _, key := range sortedKeys(target) {
+		if _, ok := source[key]; ok {
+			continue
+		}
+		if !s.options.Delete {
+			continue
+		}
+		dp := target[key]
+		if reason := s.conflict(synced, key, dp); reason != "" {
+			report.Conflicts = append(report.Conflicts, Conflict{Key: key, Reason: reason})
+			continue
+		}
+		if !dryRun {
+			if err = t.KV.DeleteCAS(ctx, key, dp.ModifyIndex); err != nil {
+				if errors.Is(err, discovery.ErrConflict) {
+					report.Conflicts = append(report.Conflicts, Conflict{Key: key, Reason: "changed on target during sync"})
+					continue
+				}
+				report.Err = err
+				return report
+			}
+			delete(synced, key)
+		}
+		report.Changes = append(report.Changes, Change{Type: Delete, Key: key, OldValue: dp.Value})
+	}
+
+	if !dryRun {
+		// forget the keys gone from both sides
+		for key := range synced {
+			if source[key] == nil && target[key] == nil {
+				delete(synced, key)
+			}
+		}
+	}
+	return report
+}
+
+// write sets the target key if its modify index is index, with the flags of the source pair when the target keeps flags
+func write(ctx context.Context, kv Store, flags bool, sp *discovery.KVPair, index uint64) error {
+	if !flags {
+		return kv.CompareAndSet(ctx, sp.Key, string(sp.Value), index)
+	}
+	_, err := kv.Txn(ctx, discovery.NewTxn().CASPair(&discovery.KVPair{Key: sp.Key, Value: sp.Value, Flags: sp.Flags, ModifyIndex: index}))
+	if errors.Is(err, discovery.ErrTxnAborted) {
+		return errors.Wrapf(discovery.ErrConflict, "cas kv error[key=%s,index=%d]", sp.Key, index)
+	}
+	return err
+}
+
+// conflict returns why the target key must not be written, it changed since the last sync
+func (s *Syncer) conflict(synced map[string]uint64, key string, dp *discovery.KVPair) string {
+	if s.options.Force {
+		return ""
+	}
+	index, ok := synced[key]
+	if !ok {
+		return ""
+	}
+	if dp == nil {
+		return "deleted on target since last sync"
+	}
+	if dp.ModifyIndex != index {
+		return fmt.Sprintf("changed on target since last sync (index %d, synced %d)", dp.ModifyIndex, index)
+	}
+	return ""
+}
+
+// list returns the pairs under the prefix matching the patterns keyed by key
+func (s *Syncer) list(ctx context.Context, kv discovery.ContextKV) (map[string]*discovery.KVPair, error) {
+	pairs, err := kv.ListPairs(ctx, s.options.Prefix)
+	if err != nil && !errors.Is(err, discovery.ErrNotFound) {
+		return nil, err
+	}
+	values := make(map[string]*discovery.KVPair, len(pairs))
+	for _, p := range pairs {
+		if s.match(p.Key) {
+			values[p.Key] = p
+		}
+	}
+	return values, nil
+}
+
+// match reports whether the key is selected by the include and exclude patterns
+func (s *Syncer) match(key string) bool {
+	rel := strings.TrimPrefix(key, s.options.Prefix)
+	for _, p := range s.options.Exclude {
+		if matchPattern(p, rel) {
+			return false
+		}
+	}
+	if len(s.options.Include) == 0 {
+		return true
+	}
+	for _, p := range s.options.Include {
+		if matchPattern(p, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPattern(pattern, key string) bool {
+	if strings.HasSuffix(pattern, "/") {
+		return strings.HasPrefix(key, pattern)
+	}
+	ok, _ := path.Match(pattern, key)
+	return ok
+}
+
+func sortedKeys(pairs map[string]*discovery.KVPair) []string {
+	keys := make([]string, 0, len(pairs))
+	for k := range pairs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
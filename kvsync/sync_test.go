@@ -0,0 +1,159 @@
+package kvsync_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+	"github.com/donetkit/contrib_discovery/kvsync"
+	"github.com/donetkit/contrib_discovery/memory"
+)
+
+func newStore(t *testing.T) *memory.Client {
+	t.Helper()
+	client, err := memory.NewWithRegistry(memory.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func set(t *testing.T, kv *memory.Client, key, value string, flags uint64) {
+	t.Helper()
+	if err := kv.SetPair(context.Background(), &discovery.KVPair{Key: key, Value: []byte(value), Flags: flags}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectPair(t *testing.T, kv *memory.Client, key, value string, flags uint64) {
+	t.Helper()
+	pair, err := kv.GetPair(context.Background(), key)
+	if err != nil {
+		t.Fatalf("GetPair(%s) = %v", key, err)
+	}
+	if string(pair.Value) != value || pair.Flags != flags {
+		t.Fatalf("GetPair(%s) = %q with flags %d, want %q with flags %d", key, pair.Value, pair.Flags, value, flags)
+	}
+}
+
+func sync(t *testing.T, syncer *kvsync.Syncer) *kvsync.Report {
+	t.Helper()
+	reports, err := syncer.Sync(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 {
+		t.Fatalf("reports = %d, want 1", len(reports))
+	}
+	return reports[0]
+}
+
+func expectChanges(t *testing.T, r *kvsync.Report, want ...kvsync.ChangeType) {
+	t.Helper()
+	if len(r.Changes) != len(want) {
+		t.Fatalf("changes = %v, want %v", r.Changes, want)
+	}
+	for i, c := range r.Changes {
+		if c.Type != want[i] {
+			t.Fatalf("changes = %v, want %v", r.Changes, want)
+		}
+	}
+}
+
+func TestSync(t *testing.T) {
+	source, target := newStore(t), newStore(t)
+	syncer, err := kvsync.New(source, []kvsync.Target{{Name: "target", KV: target}}, kvsync.WithPrefix("app/"), kvsync.WithDelete())
+	if err != nil {
+		t.Fatal(err)
+	}
+	set(t, source, "app/a", "1", 0)
+	set(t, source, "app/b", "1", 0)
+	set(t, source, "other", "1", 0)
+
+	r := sync(t, syncer)
+	expectChanges(t, r, kvsync.Create, kvsync.Create)
+	expectPair(t, target, "app/a", "1", 0)
+	if _, err := target.Get("other"); err == nil {
+		t.Fatal("synced a key out of the prefix")
+	}
+
+	set(t, source, "app/a", "2", 0)
+	if err := source.Delete("app/b"); err != nil {
+		t.Fatal(err)
+	}
+	r = sync(t, syncer)
+	expectChanges(t, r, kvsync.Update, kvsync.Delete)
+	expectPair(t, target, "app/a", "2", 0)
+	if _, err := target.Get("app/b"); err == nil {
+		t.Fatal("app/b not deleted on target")
+	}
+
+	expectChanges(t, sync(t, syncer))
+}
+
+func TestSyncFlags(t *testing.T) {
+	source, target := newStore(t), newStore(t)
+	syncer, err := kvsync.New(source, []kvsync.Target{{Name: "target", KV: target}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	set(t, source, "a", "1", 3)
+	sync(t, syncer)
+	expectPair(t, target, "a", "1", 3)
+
+	// a change of the flags alone is mirrored
+	set(t, source, "a", "1", 4)
+	r := sync(t, syncer)
+	expectChanges(t, r, kvsync.Update)
+	if r.Changes[0].Flags != 4 || r.Changes[0].OldFlags != 3 {
+		t.Fatalf("change = %+v, want flags 3 -> 4", r.Changes[0])
+	}
+	expectPair(t, target, "a", "1", 4)
+}
+
+func TestSyncConflict(t *testing.T) {
+	source, target := newStore(t), newStore(t)
+	state := filepath.Join(t.TempDir(), "state.json")
+	newSyncer := func() *kvsync.Syncer {
+		syncer, err := kvsync.New(source, []kvsync.Target{{Name: "target", KV: target}}, kvsync.WithDelete(), kvsync.WithStateFile(state))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return syncer
+	}
+	set(t, source, "a", "1", 0)
+	set(t, source, "b", "1", 0)
+	sync(t, newSyncer())
+
+	// edits made on the target between two runs are not overwritten
+	set(t, target, "a", "edited", 0)
+	if err := target.Delete("b"); err != nil {
+		t.Fatal(err)
+	}
+	set(t, target, "c", "1", 0)
+	set(t, source, "a", "2", 0)
+	set(t, source, "b", "2", 0)
+
+	syncer := newSyncer()
+	r := sync(t, syncer)
+	expectChanges(t, r, kvsync.Delete)
+	if len(r.Conflicts) != 2 || r.Conflicts[0].Key != "a" || r.Conflicts[1].Key != "b" {
+		t.Fatalf("conflicts = %v, want a and b", r.Conflicts)
+	}
+	expectPair(t, target, "a", "edited", 0)
+
+	forced, err := kvsync.New(source, []kvsync.Target{{Name: "target", KV: target}}, kvsync.WithForce(), kvsync.WithStateFile(state))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = sync(t, forced)
+	if len(r.Conflicts) != 0 {
+		t.Fatalf("conflicts = %v with force", r.Conflicts)
+	}
+	expectPair(t, target, "a", "2", 0)
+	expectPair(t, target, "b", "2", 0)
+	if r = sync(t, newSyncer()); len(r.Conflicts) != 0 || len(r.Changes) != 0 {
+		t.Fatalf("report after a forced sync = %v", r)
+	}
+}
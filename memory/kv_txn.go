@@ -0,0 +1,42 @@
+package memory
+
+import (
+	"context"
+	"strings"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+	"github.com/pkg/errors"
+)
+
+var _ discovery.TxnKV = (*Client)(nil)
+
+func (s *Client) CompareAndSet(ctx context.Context, key string, value string, index uint64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !s.registry.cas(key, []byte(value), index) {
+		return errors.Wrapf(discovery.ErrConflict, "cas kv error[key=%s,index=%d]", key, index)
+	}
+	return nil
+}
+
+func (s *Client) DeleteCAS(ctx context.Context, key string, index uint64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !s.registry.deleteCAS(key, index) {
+		return errors.Wrapf(discovery.ErrConflict, "delete cas kv error[key=%s,index=%d]", key, index)
+	}
+	return nil
+}
+
+func (s *Client) Txn(ctx context.Context, txn *discovery.Txn) ([]*discovery.KVPair, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	pairs, what := s.registry.txn(txn.Ops)
+	if len(what) > 0 {
+		return nil, errors.Wrap(discovery.ErrTxnAborted, strings.Join(what, "; "))
+	}
+	return pairs, nil
+}
@@ -0,0 +1,79 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+)
+
+var _ discovery.KVWatcher = (*Client)(nil)
+
+// WatchKey sends the value of the key on every change
+func (s *Client) WatchKey(ctx context.Context, key string) (<-chan discovery.KVUpdate, error) {
+	return s.watchKV(ctx, key, false), nil
+}
+
+// WatchPrefix sends the changed keys under the prefix on every change
+func (s *Client) WatchPrefix(ctx context.Context, prefix string) (<-chan discovery.KVUpdate, error) {
+	return s.watchKV(ctx, prefix, true), nil
+}
+
+func (s *Client) watchKV(ctx context.Context, key string, prefix bool) <-chan discovery.KVUpdate {
+	ch := make(chan discovery.KVUpdate, 1)
+	go func() {
+		defer close(ch)
+		known := make(map[string]uint64)
+		for first := true; ; first = false {
+			pairs, index, changed := s.registry.pairs(key, prefix)
+
+			keys := make([]string, 0, len(pairs))
+			for k := range pairs {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+
+			var updates []discovery.KVUpdate
+			for _, k := range keys {
+				pair := pairs[k]
+				if old, ok := known[k]; !ok || old != pair.modifyIndex {
+					updates = append(updates, discovery.KVUpdate{Key: k, Value: pair.value, ModifyIndex: pair.modifyIndex})
+				}
+			}
+			var deleted []string
+			for k := range known {
+				if _, ok := pairs[k]; !ok {
+					deleted = append(deleted, k)
+				}
+			}
+			sort.Strings(deleted)
+			for _, k := range deleted {
+				updates = append(updates, discovery.KVUpdate{Key: k, ModifyIndex: index, Deleted: true})
+			}
+			if first && !prefix && len(pairs) == 0 {
+				// the key is missing at the start
+				updates = append(updates, discovery.KVUpdate{Key: key, ModifyIndex: index, Deleted: true})
+			}
+
+			known = make(map[string]uint64, len(pairs))
+			for k, pair := range pairs {
+				known[k] = pair.modifyIndex
+			}
+
+			for _, update := range updates {
+				select {
+				case <-ctx.Done():
+					return
+				case ch <- update:
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-changed:
+			}
+		}
+	}()
+	return ch
+}
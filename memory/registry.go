@@ -0,0 +1,316 @@
+package memory
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+)
+
+// DefaultRegistry is the registry shared by clients created with New
+var DefaultRegistry = NewRegistry()
+
+// Registry is an in-memory service catalog and key/value store, it plays the part of the Consul agent
+type Registry struct {
+	mu       sync.RWMutex
+	services map[string]map[string]*discovery.DefaultServiceInstance
+	kv       map[string]*kvPair
+	watchers map[*Watcher]struct{}
+	index    uint64
+	// kvChanged is closed and replaced on every KV write to wake KV watches
+	kvChanged chan struct{}
+}
+
+type kvPair struct {
+	value       []byte
+	modifyIndex uint64
+	flags       uint64
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		services:  make(map[string]map[string]*discovery.DefaultServiceInstance),
+		kv:        make(map[string]*kvPair),
+		watchers:  make(map[*Watcher]struct{}),
+		kvChanged: make(chan struct{}),
+	}
+}
+
+func (r *Registry) register(ins *discovery.DefaultServiceInstance) {
+	r.mu.Lock()
+	before := r.nodesLocked(ins.ServiceName)
+	nodes, ok := r.services[ins.ServiceName]
+	if !ok {
+		nodes = make(map[string]*discovery.DefaultServiceInstance)
+		r.services[ins.ServiceName] = nodes
+	}
+	nodes[ins.Id] = copyInstance(ins)
+	after := r.nodesLocked(ins.ServiceName)
+	r.index++
+	r.notifyLocked(r.index, ins.ServiceName, before, after)
+	r.mu.Unlock()
+}
+
+func (r *Registry) deregister(name, id string) bool {
+	r.mu.Lock()
+	nodes, ok := r.services[name]
+	if !ok {
+		r.mu.Unlock()
+		return false
+	}
+	if _, ok = nodes[id]; !ok {
+		r.mu.Unlock()
+		return false
+	}
+	before := r.nodesLocked(name)
+	delete(nodes, id)
+	if len(nodes) == 0 {
+		delete(r.services, name)
+	}
+	after := r.nodesLocked(name)
+	r.index++
+	r.notifyLocked(r.index, name, before, after)
+	r.mu.Unlock()
+	return true
+}
+
+// Services returns a copy of the registered services
+func (r *Registry) Services() map[string][]discovery.ServiceInstance {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	services := make(map[string][]discovery.ServiceInstance, len(r.services))
+	for name := range r.services {
+		services[name] = r.nodesLocked(name)
+	}
+	return services
+}
+
+func (r *Registry) nodesLocked(name string) []discovery.ServiceInstance {
+	nodes := r.services[name]
+	if len(nodes) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(nodes))
+	for id := range nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	instances := make([]discovery.ServiceInstance, 0, len(ids))
+	for _, id := range ids {
+		instances = append(instances, copyInstance(nodes[id]))
+	}
+	return instances
+}
+
+// addWatcher queues the current services as the first events of the watcher, under the lock
+// so no change can be queued before them
+func (r *Registry) addWatcher(w *Watcher) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.watchers[w] = struct{}{}
+	names := make([]string, 0, len(r.services))
+	for name := range r.services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		w.changed(r.index, name, nil, r.nodesLocked(name))
+	}
+}
+
+func (r *Registry) removeWatcher(w *Watcher) {
+	r.mu.Lock()
+	delete(r.watchers, w)
+	r.mu.Unlock()
+}
+
+// notifyLocked queues the change to the watchers, it is called under the lock
+// so concurrent changes are queued in index order
+func (r *Registry) notifyLocked(index uint64, name string, before, after []discovery.ServiceInstance) {
+	for w := range r.watchers {
+		w.changed(index, name, before, after)
+	}
+}
+
+func (r *Registry) get(key string) ([]byte, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	pair, ok := r.kv[key]
+	if !ok {
+		return nil, false
+	}
+	return append([]byte(nil), pair.value...), true
+}
+
+func (r *Registry) set(key string, value []byte, flags uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.index++
+	r.kv[key] = &kvPair{value: append([]byte(nil), value...), modifyIndex: r.index, flags: flags}
+	r.kvNotifyLocked()
+}
+
+func (r *Registry) delete(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.kv[key]; !ok {
+		return
+	}
+	r.index++
+	delete(r.kv, key)
+	r.kvNotifyLocked()
+}
+
+// cas writes the key if its modify index is index, 0 only creates the key. The flags of the key are kept.
+func (r *Registry) cas(key string, value []byte, index uint64) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pair, ok := r.kv[key]
+	if (index == 0 && ok) || (index != 0 && (!ok || pair.modifyIndex != index)) {
+		return false
+	}
+	var flags uint64
+	if ok {
+		flags = pair.flags
+	}
+	r.index++
+	r.kv[key] = &kvPair{value: append([]byte(nil), value...), modifyIndex: r.index, flags: flags}
+	r.kvNotifyLocked()
+	return true
+}
+
+// deleteCAS removes the key if its modify index is index, a missing key succeeds
+func (r *Registry) deleteCAS(key string, index uint64) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pair, ok := r.kv[key]
+	if !ok {
+		return true
+	}
+	if pair.modifyIndex != index {
+		return false
+	}
+	r.index++
+	delete(r.kv, key)
+	r.kvNotifyLocked()
+	return true
+}
+
+// txn applies the operations in order on a staged copy of the keys, committed with a single index
+// if every operation succeeds. It returns the pairs read by the get operations, or the reason of the failure.
+func (r *Registry) txn(ops []discovery.TxnOp) ([]*discovery.KVPair, []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	index := r.index + 1
+	// staged holds the written keys, nil for deleted keys
+	staged := make(map[string]*kvPair)
+	lookup := func(key string) (*kvPair, bool) {
+		if pair, ok := staged[key]; ok {
+			return pair, pair != nil
+		}
+		pair, ok := r.kv[key]
+		return pair, ok
+	}
+
+	var what []string
+	var gets []*discovery.KVPair
+	for i, op := range ops {
+		pair, ok := lookup(op.Key)
+		switch op.Verb {
+		case discovery.TxnGet:
+			if !ok {
+				what = append(what, fmt.Sprintf("op %d: key %q doesn't exist", i, op.Key))
+				continue
+			}
+			gets = append(gets, &discovery.KVPair{
+				Key:         op.Key,
+				Value:       append([]byte(nil), pair.value...),
+				ModifyIndex: pair.modifyIndex,
+				Flags:       pair.flags,
+			})
+		case discovery.TxnCheckIndex:
+			if !ok {
+				what = append(what, fmt.Sprintf("op %d: key %q doesn't exist", i, op.Key))
+			} else if pair.modifyIndex != op.Index {
+				what = append(what, fmt.Sprintf("op %d: current modify index %d != %d", i, pair.modifyIndex, op.Index))
+			}
+		case discovery.TxnSet:
+			staged[op.Key] = &kvPair{value: append([]byte(nil), op.Value...), modifyIndex: index, flags: op.Flags}
+		case discovery.TxnCAS:
+			if (op.Index == 0 && ok) || (op.Index != 0 && (!ok || pair.modifyIndex != op.Index)) {
+				what = append(what, fmt.Sprintf("op %d: failed to set key %q, index is stale", i, op.Key))
+				continue
+			}
+			staged[op.Key] = &kvPair{value: append([]byte(nil), op.Value...), modifyIndex: index, flags: op.Flags}
+		case discovery.TxnDelete:
+			staged[op.Key] = nil
+		default:
+			what = append(what, fmt.Sprintf("op %d: unknown verb %q", i, op.Verb))
+		}
+	}
+	if len(what) > 0 {
+		return nil, what
+	}
+	if len(staged) == 0 {
+		return gets, nil
+	}
+
+	r.index = index
+	for key, pair := range staged {
+		if pair == nil {
+			delete(r.kv, key)
+		} else {
+			r.kv[key] = pair
+		}
+	}
+	r.kvNotifyLocked()
+	return gets, nil
+}
+
+func (r *Registry) list(prefix string) map[string][]byte {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	values := make(map[string][]byte)
+	for k, pair := range r.kv {
+		if strings.HasPrefix(k, prefix) {
+			values[k] = append([]byte(nil), pair.value...)
+		}
+	}
+	return values
+}
+
+// pairs returns the keys matching key or prefix with their modify index, and the channel closed on the next write
+func (r *Registry) pairs(key string, prefix bool) (map[string]*kvPair, uint64, <-chan struct{}) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	pairs := make(map[string]*kvPair)
+	for k, pair := range r.kv {
+		if k == key || (prefix && strings.HasPrefix(k, key)) {
+			pairs[k] = &kvPair{value: append([]byte(nil), pair.value...), modifyIndex: pair.modifyIndex, flags: pair.flags}
+		}
+	}
+	return pairs, r.index, r.kvChanged
+}
+
+// kvNotifyLocked wakes the KV watches, r.mu must be held
+func (r *Registry) kvNotifyLocked() {
+	close(r.kvChanged)
+	r.kvChanged = make(chan struct{})
+}
+
+func copyInstance(ins *discovery.DefaultServiceInstance) *discovery.DefaultServiceInstance {
+	n := new(discovery.DefaultServiceInstance)
+	*n = *ins
+	n.Tags = append([]string(nil), ins.Tags...)
+	if ins.Metadata != nil {
+		n.Metadata = make(map[string]string, len(ins.Metadata))
+		for k, v := range ins.Metadata {
+			n.Metadata[k] = v
+		}
+	}
+	return n
+}
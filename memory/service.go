@@ -0,0 +1,89 @@
+package memory
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+	"github.com/pkg/errors"
+)
+
+var (
+	_ discovery.Discovery = (*Client)(nil)
+	_ discovery.KV        = (*Client)(nil)
+)
+
+// Client implements discovery.Discovery, discovery.KV and watches on top of a Registry
+type Client struct {
+	registry *Registry
+	options  *discovery.Config
+}
+
+// New returns a client of DefaultRegistry
+func New(opts ...discovery.Option) (*Client, error) {
+	return NewWithRegistry(DefaultRegistry, opts...)
+}
+
+// NewWithRegistry returns a client of the registry
+func NewWithRegistry(registry *Registry, opts ...discovery.Option) (*Client, error) {
+	cfg := &discovery.Config{
+		Id:             fmt.Sprintf("xd%d", time.Now().UnixNano()),
+		Name:           "Service",
+		RegisterAddr:   "127.0.0.1",
+		RegisterPort:   8500,
+		CheckAddr:      "127.0.0.1",
+		CheckPort:      80,
+		Version:        discovery.DefaultVersion,
+		IntervalTime:   15,
+		DeregisterTime: 15,
+		TimeOut:        3,
+		CheckResponse:  &discovery.CheckResponse{RetryCount: 3},
+		CheckType:      "TCP",
+		NodeAddr:       map[string]string{},
+	}
+	cfg.CheckResponse.SetHealthy("Healthy")
+	cfg.HttpRouter = func(r *discovery.CheckResponse) {}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if registry == nil {
+		registry = DefaultRegistry
+	}
+	return &Client{registry: registry, options: cfg}, nil
+}
+
+// Registry returns the registry of the client
+func (s *Client) Registry() *Registry {
+	return s.registry
+}
+
+// SetTags set tags []string
+func (s *Client) SetTags(tags ...string) {
+	s.options.Tags = tags
+}
+
+func (s *Client) Register() error {
+	weight := s.options.WeightPassing
+	if weight <= 0 {
+		weight = 1
+	}
+	s.registry.register(&discovery.DefaultServiceInstance{
+		Id:          s.options.Id,
+		ServiceName: s.options.Name,
+		Host:        s.options.CheckAddr,
+		Port:        uint64(s.options.CheckPort),
+		Tags:        append([]string(nil), s.options.Tags...),
+		Enable:      true,
+		Healthy:     true,
+		Weight:      float64(weight),
+		Metadata:    s.options.ServiceMetadata(),
+	})
+	return nil
+}
+
+func (s *Client) Deregister() error {
+	if !s.registry.deregister(s.options.Name, s.options.Id) {
+		return errors.Wrapf(discovery.ErrServiceNotFound, "deregister service error[key=%s]", s.options.Id)
+	}
+	return nil
+}
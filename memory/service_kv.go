@@ -0,0 +1,117 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+	"github.com/pkg/errors"
+)
+
+var (
+	_ discovery.ContextKV  = (*Client)(nil)
+	_ discovery.PairSetter = (*Client)(nil)
+)
+
+func (s *Client) Get(key string) ([]byte, error) {
+	return s.GetContext(context.Background(), key)
+}
+
+func (s *Client) Set(key string, value string) error {
+	return s.SetContext(context.Background(), key, value)
+}
+
+func (s *Client) Delete(key string) error {
+	return s.DeleteContext(context.Background(), key)
+}
+
+func (s *Client) List(key string) (map[string][]byte, error) {
+	return s.ListContext(context.Background(), key)
+}
+
+func (s *Client) GetContext(ctx context.Context, key string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	value, ok := s.registry.get(key)
+	if !ok {
+		return nil, errors.Wrapf(discovery.ErrNotFound, "get kv error[key=%s]", key)
+	}
+	return value, nil
+}
+
+func (s *Client) SetContext(ctx context.Context, key string, value string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.registry.set(key, []byte(value), 0)
+	return nil
+}
+
+func (s *Client) SetPair(ctx context.Context, pair *discovery.KVPair) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.registry.set(pair.Key, pair.Value, pair.Flags)
+	return nil
+}
+
+func (s *Client) DeleteContext(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.registry.delete(key)
+	return nil
+}
+
+func (s *Client) ListContext(ctx context.Context, key string) (map[string][]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	values := s.registry.list(key)
+	if len(values) == 0 {
+		return nil, errors.Wrapf(discovery.ErrNotFound, "list kv error[prefix=%s]", key)
+	}
+	return values, nil
+}
+
+func (s *Client) GetPair(ctx context.Context, key string) (*discovery.KVPair, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	pairs, _, _ := s.registry.pairs(key, false)
+	pair, ok := pairs[key]
+	if !ok {
+		return nil, errors.Wrapf(discovery.ErrNotFound, "get kv error[key=%s]", key)
+	}
+	return newKVPair(key, pair), nil
+}
+
+func (s *Client) ListPairs(ctx context.Context, prefix string) ([]*discovery.KVPair, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	pairs, _, _ := s.registry.pairs(prefix, true)
+	if len(pairs) == 0 {
+		return nil, errors.Wrapf(discovery.ErrNotFound, "list kv error[prefix=%s]", prefix)
+	}
+	keys := make([]string, 0, len(pairs))
+	for k := range pairs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	list := make([]*discovery.KVPair, 0, len(keys))
+	for _, k := range keys {
+		list = append(list, newKVPair(k, pairs[k]))
+	}
+	return list, nil
+}
+
+func newKVPair(key string, pair *kvPair) *discovery.KVPair {
+	return &discovery.KVPair{
+		Key:         key,
+		Value:       pair.value,
+		ModifyIndex: pair.modifyIndex,
+		Flags:       pair.flags,
+	}
+}
@@ -0,0 +1,210 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+	"github.com/pkg/errors"
+)
+
+func TestKV(t *testing.T) {
+	client, err := NewWithRegistry(NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Get("app/a"); !errors.Is(err, discovery.ErrNotFound) {
+		t.Fatalf("Get missing = %v, want %v", err, discovery.ErrNotFound)
+	}
+	if err := client.Set("app/a", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Set("app/b", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Set("other", "3"); err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := client.Get("app/a")
+	if err != nil || string(value) != "1" {
+		t.Fatalf("Get = %q, %v, want 1", value, err)
+	}
+	values, err := client.List("app/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 2 || string(values["app/a"]) != "1" || string(values["app/b"]) != "2" {
+		t.Fatalf("List = %v", values)
+	}
+
+	if err := client.Delete("app/a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Get("app/a"); !errors.Is(err, discovery.ErrNotFound) {
+		t.Fatalf("Get deleted = %v, want %v", err, discovery.ErrNotFound)
+	}
+	if _, err := client.List("none/"); !errors.Is(err, discovery.ErrNotFound) {
+		t.Fatalf("List missing = %v, want %v", err, discovery.ErrNotFound)
+	}
+}
+
+func TestWatchKey(t *testing.T) {
+	client, err := NewWithRegistry(NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	updates, err := client.WatchKey(ctx, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := func() discovery.KVUpdate {
+		t.Helper()
+		select {
+		case u := <-updates:
+			return u
+		case <-time.After(time.Second):
+			t.Fatal("no update")
+		}
+		return discovery.KVUpdate{}
+	}
+
+	if u := next(); u.Key != "k" || !u.Deleted {
+		t.Fatalf("first update = %+v, want a deleted k", u)
+	}
+	if err := client.Set("k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if u := next(); u.Key != "k" || u.Deleted || string(u.Value) != "v" {
+		t.Fatalf("update = %+v, want k=v", u)
+	}
+	if err := client.Set("k2", "ignored"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Delete("k"); err != nil {
+		t.Fatal(err)
+	}
+	if u := next(); u.Key != "k" || !u.Deleted {
+		t.Fatalf("update = %+v, want a deleted k", u)
+	}
+}
+
+func TestWatchPrefix(t *testing.T) {
+	client, err := NewWithRegistry(NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Set("app/a", "1"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	updates, err := client.WatchPrefix(ctx, "app/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := func() discovery.KVUpdate {
+		t.Helper()
+		select {
+		case u := <-updates:
+			return u
+		case <-time.After(time.Second):
+			t.Fatal("no update")
+		}
+		return discovery.KVUpdate{}
+	}
+
+	if u := next(); u.Key != "app/a" || string(u.Value) != "1" {
+		t.Fatalf("first update = %+v, want app/a=1", u)
+	}
+	if err := client.Set("app/b", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if u := next(); u.Key != "app/b" || string(u.Value) != "2" {
+		t.Fatalf("update = %+v, want app/b=2", u)
+	}
+	if err := client.Delete("app/a"); err != nil {
+		t.Fatal(err)
+	}
+	if u := next(); u.Key != "app/a" || !u.Deleted {
+		t.Fatalf("update = %+v, want a deleted app/a", u)
+	}
+
+	cancel()
+	for range updates {
+	}
+}
+
+func TestTxn(t *testing.T) {
+	client, err := NewWithRegistry(NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := client.Set("a", "1"); err != nil {
+		t.Fatal(err)
+	}
+	pair, err := client.GetPair(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.CompareAndSet(ctx, "a", "2", pair.ModifyIndex+1); !errors.Is(err, discovery.ErrConflict) {
+		t.Fatalf("CompareAndSet stale = %v, want %v", err, discovery.ErrConflict)
+	}
+	if err := client.CompareAndSet(ctx, "a", "2", pair.ModifyIndex); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CompareAndSet(ctx, "new", "1", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CompareAndSet(ctx, "new", "1", 0); !errors.Is(err, discovery.ErrConflict) {
+		t.Fatalf("CompareAndSet existing = %v, want %v", err, discovery.ErrConflict)
+	}
+
+	pairs, err := client.Txn(ctx, discovery.NewTxn().Set("b", "1").Get("b").Delete("new").Get("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pairs) != 2 || string(pairs[0].Value) != "1" || string(pairs[1].Value) != "2" {
+		t.Fatalf("Txn pairs = %+v", pairs)
+	}
+
+	_, err = client.Txn(ctx, discovery.NewTxn().Set("c", "1").CheckIndex("a", 1))
+	if !errors.Is(err, discovery.ErrTxnAborted) {
+		t.Fatalf("Txn with a stale index = %v, want %v", err, discovery.ErrTxnAborted)
+	}
+	if _, err := client.Get("c"); !errors.Is(err, discovery.ErrNotFound) {
+		t.Fatalf("aborted Txn wrote c: %v", err)
+	}
+}
+
+func TestCompareAndSetKeepsFlags(t *testing.T) {
+	client, err := NewWithRegistry(NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := client.SetPair(ctx, &discovery.KVPair{Key: "a", Value: []byte("1"), Flags: 7}); err != nil {
+		t.Fatal(err)
+	}
+	pair, err := client.GetPair(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CompareAndSet(ctx, "a", "2", pair.ModifyIndex); err != nil {
+		t.Fatal(err)
+	}
+	if pair, err = client.GetPair(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if string(pair.Value) != "2" || pair.Flags != 7 {
+		t.Fatalf("GetPair = %+v, want value 2 with flags 7", pair)
+	}
+}
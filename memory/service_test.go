@@ -0,0 +1,28 @@
+package memory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+)
+
+func TestDefaultVersion(t *testing.T) {
+	client, err := NewWithRegistry(NewRegistry(), discovery.WithId("a"), discovery.WithName("svc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.Register(); err != nil {
+		t.Fatal(err)
+	}
+	services, err := client.GetService(context.Background(), "svc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 1 || services[0].Version != discovery.DefaultVersion {
+		t.Fatalf("GetService = %+v, want the version %s", services, discovery.DefaultVersion)
+	}
+	if tags := services[0].Nodes[0].GetTags(); len(tags) != 0 {
+		t.Fatalf("tags = %v, want none", tags)
+	}
+}
@@ -0,0 +1,76 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+	"github.com/donetkit/contrib_discovery/watcher"
+)
+
+var _ watcher.EventWatcher = (*Watcher)(nil)
+
+// Watcher emits the same create/update/delete results as the consul watcher
+type Watcher struct {
+	registry *Registry
+	option   watcher.WatchOptions
+	queue    *watcher.Queue
+	stopOnce sync.Once
+}
+
+// Watch returns a watcher of the registry, it is stopped when ctx (or WatchOptions.Context, if set) is done
+func (s *Client) Watch(ctx context.Context, opts ...watcher.WatchOption) (watcher.EventWatcher, error) {
+	return newWatcher(s.registry, append([]watcher.WatchOption{watcher.WatchContext(ctx)}, opts...)...)
+}
+
+func newWatcher(registry *Registry, opts ...watcher.WatchOption) (*Watcher, error) {
+	var wo watcher.WatchOptions
+	for _, o := range opts {
+		o(&wo)
+	}
+	if wo.Context == nil {
+		wo.Context = context.Background()
+	}
+
+	w := &Watcher{
+		registry: registry,
+		option:   wo,
+		queue:    watcher.NewQueue(),
+	}
+	registry.addWatcher(w)
+
+	go func() {
+		select {
+		case <-wo.Context.Done():
+			w.Stop()
+		case <-w.queue.Done():
+		}
+	}()
+	return w, nil
+}
+
+func (w *Watcher) Next() (*watcher.Result, error) {
+	return w.queue.Next()
+}
+
+// Events returns the typed events of the watcher, with the registry index as Id.
+// Events and Next consume the same stream, use one of them.
+// The channel is closed when the watcher is stopped.
+func (w *Watcher) Events() <-chan watcher.Event {
+	return w.queue.Events()
+}
+
+func (w *Watcher) Stop() {
+	w.stopOnce.Do(func() {
+		w.queue.Close()
+		w.registry.removeWatcher(w)
+	})
+}
+
+// changed queues the events for the nodes of a service changing from before to after
+func (w *Watcher) changed(idx uint64, name string, before, after []discovery.ServiceInstance) {
+	if len(w.option.Service) > 0 && name != w.option.Service {
+		return
+	}
+	w.queue.Push(watcher.Diff(idx, name, w.option.Select(before), w.option.Select(after))...)
+}
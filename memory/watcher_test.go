@@ -0,0 +1,201 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+	"github.com/donetkit/contrib_discovery/watcher"
+	"github.com/pkg/errors"
+)
+
+func newTestClient(t *testing.T, registry *Registry, id string, version string) *Client {
+	t.Helper()
+	client, err := NewWithRegistry(registry, discovery.WithId(id), discovery.WithName("svc"), discovery.WithVersion(version))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func nextEvent(t *testing.T, events <-chan watcher.Event) watcher.Event {
+	t.Helper()
+	select {
+	case e, ok := <-events:
+		if !ok {
+			t.Fatal("events closed")
+		}
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("no event")
+	}
+	return watcher.Event{}
+}
+
+func nodeIds(service *discovery.Service) []string {
+	var ids []string
+	for _, node := range service.Nodes {
+		ids = append(ids, node.GetId())
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func expectEvent(t *testing.T, events <-chan watcher.Event, typ watcher.EventType, version string, ids ...string) {
+	t.Helper()
+	e := nextEvent(t, events)
+	if e.Type != typ || e.Service.Name != "svc" || e.Service.Version != version {
+		t.Fatalf("event = %s %s@%s, want %s svc@%s", e.Type, e.Service.Name, e.Service.Version, typ, version)
+	}
+	if got := nodeIds(e.Service); strings.Join(got, ",") != strings.Join(ids, ",") {
+		t.Fatalf("%s svc@%s nodes = %v, want %v", typ, version, got, ids)
+	}
+}
+
+func TestWatcherEvents(t *testing.T) {
+	registry := NewRegistry()
+	a := newTestClient(t, registry, "a", "1.0.0")
+	if err := a.Register(); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := a.Watch(context.Background(), watcher.WatchService("svc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+	events := w.Events()
+
+	// the registered instances are the first events
+	expectEvent(t, events, watcher.Create, "")
+	expectEvent(t, events, watcher.Create, "1.0.0", "a")
+
+	b := newTestClient(t, registry, "b", "1.0.0")
+	if err := b.Register(); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, events, watcher.Update, "1.0.0", "a", "b")
+
+	c := newTestClient(t, registry, "c", "2.0.0")
+	if err := c.Register(); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, events, watcher.Update, "1.0.0", "a", "b")
+	expectEvent(t, events, watcher.Create, "2.0.0", "c")
+
+	if err := a.Deregister(); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, events, watcher.Delete, "1.0.0", "a")
+	expectEvent(t, events, watcher.Update, "1.0.0", "b")
+	expectEvent(t, events, watcher.Update, "2.0.0", "c")
+
+	if err := b.Deregister(); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, events, watcher.Update, "2.0.0", "c")
+	expectEvent(t, events, watcher.Delete, "1.0.0", "b")
+
+	if err := c.Deregister(); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, events, watcher.Delete, "2.0.0", "c")
+	expectEvent(t, events, watcher.Delete, "")
+
+	if err := c.Deregister(); !errors.Is(err, discovery.ErrServiceNotFound) {
+		t.Fatalf("deregister of a missing instance = %v, want %v", err, discovery.ErrServiceNotFound)
+	}
+}
+
+func TestWatcherNext(t *testing.T) {
+	registry := NewRegistry()
+	client := newTestClient(t, registry, "a", "1.0.0")
+
+	w, err := client.Watch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Register(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"create", "create"} {
+		result, err := w.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Action != want || result.Service.Name != "svc" {
+			t.Fatalf("result = %s %s, want %s svc", result.Action, result.Service.Name, want)
+		}
+	}
+
+	w.Stop()
+	if _, err := w.Next(); err != watcher.ErrStopped {
+		t.Fatalf("Next after Stop = %v, want %v", err, watcher.ErrStopped)
+	}
+}
+
+func TestWatcherContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	w, err := newTestClient(t, NewRegistry(), "a", "1.0.0").Watch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := w.Events()
+	cancel()
+
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Fatal("unexpected event")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("events not closed after the context is done")
+	}
+}
+
+// TestWatcherOrder checks that concurrent registrations are queued in registry index order
+func TestWatcherOrder(t *testing.T) {
+	registry := NewRegistry()
+	w, err := newWatcher(registry, watcher.WatchService("svc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	const n = 50
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			registry.register(&discovery.DefaultServiceInstance{Id: strconv.Itoa(i), ServiceName: "svc", Healthy: true})
+		}(i)
+	}
+	wg.Wait()
+
+	var last uint64
+	var nodes int
+	for nodes < n {
+		e := nextEvent(t, w.Events())
+		id, err := strconv.ParseUint(e.Id, 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id < last {
+			t.Fatalf("event %d queued after event %d", id, last)
+		}
+		last = id
+		if got := len(e.Service.Nodes); e.Type != watcher.Delete && got > 0 {
+			if got < nodes {
+				t.Fatalf("event %d has %d nodes after %d", id, got, nodes)
+			}
+			nodes = got
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/donetkit/contrib_discovery/balancer"
+	"github.com/donetkit/contrib_discovery/consul"
+	"github.com/donetkit/contrib_discovery/discovery"
+	"github.com/donetkit/contrib_discovery/watcher"
+	"github.com/pkg/errors"
+	grpcResolver "google.golang.org/grpc/resolver"
+)
+
+// Scheme is the gRPC target scheme handled by this resolver,
+// e.g. grpc.Dial("consul://127.0.0.1:8500/my-service?tag=v1&healthy=true")
+const Scheme = "consul"
+
+const defaultPort = 8500
+
+func init() {
+	grpcResolver.Register(NewBuilder())
+}
+
+// builder shares a consul client between the resolvers of the same agent and token
+type builder struct {
+	mu      sync.Mutex
+	clients map[clientKey]*sharedClient
+}
+
+type clientKey struct {
+	host  string
+	port  int
+	token string
+}
+
+type sharedClient struct {
+	client *consul.Client
+	refs   int
+}
+
+// NewBuilder returns a resolver.Builder for the consul scheme
+func NewBuilder() grpcResolver.Builder {
+	return &builder{clients: make(map[clientKey]*sharedClient)}
+}
+
+func (b *builder) Scheme() string {
+	return Scheme
+}
+
+func (b *builder) Build(target grpcResolver.Target, cc grpcResolver.ClientConn, _ grpcResolver.BuildOptions) (grpcResolver.Resolver, error) {
+	t, err := parseTarget(target.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	key := clientKey{host: t.host, port: t.port, token: t.token}
+	client, err := b.acquire(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "create consul resolver error")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	opts := []watcher.WatchOption{watcher.WatchService(t.service), watcher.WatchTags(t.tags...)}
+	if t.healthy {
+		opts = append(opts, watcher.WatchPassingOnly())
+	}
+	w, err := client.Watch(ctx, opts...)
+	if err != nil {
+		cancel()
+		b.release(key)
+		return nil, errors.Wrap(err, "watch service error")
+	}
+
+	r := &consulResolver{
+		target:   t,
+		cc:       cc,
+		watcher:  w,
+		cancel:   cancel,
+		release:  func() { b.release(key) },
+		services: make(map[string][]discovery.ServiceInstance),
+	}
+	r.wg.Add(1)
+	go r.watch()
+	return r, nil
+}
+
+// acquire returns the client of the agent, created on first use
+func (b *builder) acquire(key clientKey) (*consul.Client, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if shared, ok := b.clients[key]; ok {
+		shared.refs++
+		return shared.client, nil
+	}
+	client, err := consul.New(discovery.WithRegisterAddr(key.host), discovery.WithRegisterPort(key.port), discovery.WithToken(key.token))
+	if err != nil {
+		return nil, err
+	}
+	b.clients[key] = &sharedClient{client: client, refs: 1}
+	return client, nil
+}
+
+// release closes the client of the agent once no resolver uses it
+func (b *builder) release(key clientKey) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	shared, ok := b.clients[key]
+	if !ok {
+		return
+	}
+	if shared.refs--; shared.refs == 0 {
+		delete(b.clients, key)
+		shared.client.Close()
+	}
+}
+
+type target struct {
+	host    string
+	port    int
+	token   string
+	service string
+	tags    []string
+	healthy bool
+}
+
+func parseTarget(u url.URL) (*target, error) {
+	t := &target{
+		host:    u.Hostname(),
+		port:    defaultPort,
+		service: strings.Trim(u.Path, "/"),
+	}
+	if t.host == "" {
+		t.host = "127.0.0.1"
+	}
+	if p := u.Port(); p != "" {
+		port, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid consul port[target=%s]", u.String())
+		}
+		t.port = port
+	}
+	if t.service == "" {
+		return nil, fmt.Errorf("service name is empty[target=%s]", u.String())
+	}
+
+	query := u.Query()
+	t.token = query.Get("token")
+	for _, tag := range query["tag"] {
+		if tag != "" {
+			t.tags = append(t.tags, strings.Split(tag, ",")...)
+		}
+	}
+	if healthy := query.Get("healthy"); healthy != "" {
+		v, err := strconv.ParseBool(healthy)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid healthy value[target=%s]", u.String())
+		}
+		t.healthy = v
+	}
+	return t, nil
+}
+
+type consulResolver struct {
+	target  *target
+	cc      grpcResolver.ClientConn
+	watcher watcher.Watcher
+	cancel  context.CancelFunc
+	release func()
+	wg      sync.WaitGroup
+	once    sync.Once
+
+	// services are the current instances keyed by service version
+	services map[string][]discovery.ServiceInstance
+}
+
+func (r *consulResolver) ResolveNow(grpcResolver.ResolveNowOptions) {}
+
+// Close stops the watch and releases the shared consul client
+func (r *consulResolver) Close() {
+	r.once.Do(func() {
+		r.cancel()
+		r.watcher.Stop()
+		r.wg.Wait()
+		r.release()
+	})
+}
+
+func (r *consulResolver) watch() {
+	defer r.wg.Done()
+	for {
+		res, err := r.watcher.Next()
+		if err != nil {
+			return
+		}
+		if r.apply(res) {
+			r.update()
+		}
+	}
+}
+
+// apply merges a watcher result into the current instances and reports whether they changed
+func (r *consulResolver) apply(res *watcher.Result) bool {
+	if res == nil || res.Service == nil {
+		return false
+	}
+	svc := res.Service
+	switch res.Action {
+	case "create", "update":
+		if len(svc.Nodes) == 0 && res.Action == "create" {
+			// the service itself was discovered, its nodes follow
+			return false
+		}
+		r.services[svc.Version] = svc.Nodes
+	case "delete":
+		if len(svc.Nodes) == 0 {
+			if svc.Version == "" {
+				r.services = make(map[string][]discovery.ServiceInstance)
+			} else {
+				delete(r.services, svc.Version)
+			}
+			return true
+		}
+		var nodes []discovery.ServiceInstance
+		for _, node := range r.services[svc.Version] {
+			var removed bool
+			for _, del := range svc.Nodes {
+				if del.GetId() == node.GetId() {
+					removed = true
+					break
+				}
+			}
+			if !removed {
+				nodes = append(nodes, node)
+			}
+		}
+		r.services[svc.Version] = nodes
+	default:
+		return false
+	}
+	return true
+}
+
+func (r *consulResolver) update() {
+	var addrs []grpcResolver.Address
+	for _, nodes := range r.services {
+		for _, node := range nodes {
+			if !r.match(node) {
+				continue
+			}
+			addrs = append(addrs, balancer.SetInstance(grpcResolver.Address{
+				Addr:       net.JoinHostPort(node.GetHost(), strconv.FormatUint(node.GetPort(), 10)),
+				ServerName: node.GetServiceName(),
+			}, node))
+		}
+	}
+	if len(addrs) == 0 {
+		r.cc.ReportError(fmt.Errorf("no available instance[service=%s]", r.target.service))
+		return
+	}
+	_ = r.cc.UpdateState(grpcResolver.State{Addresses: addrs})
+}
+
+func (r *consulResolver) match(node discovery.ServiceInstance) bool {
+	if !node.IsEnable() {
+		return false
+	}
+	if r.target.healthy && !node.IsHealthy() {
+		return false
+	}
+	for _, tag := range r.target.tags {
+		var found bool
+		for _, t := range node.GetTags() {
+			if t == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,135 @@
+package resolver
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/donetkit/contrib_discovery/consul"
+	"github.com/donetkit/contrib_discovery/consultest"
+	"github.com/donetkit/contrib_discovery/discovery"
+	grpcResolver "google.golang.org/grpc/resolver"
+)
+
+// clientConn records the addresses of the states, an error is recorded as no address
+type clientConn struct {
+	grpcResolver.ClientConn
+	addrs chan []string
+}
+
+func (c *clientConn) UpdateState(s grpcResolver.State) error {
+	if c.addrs != nil {
+		var addrs []string
+		for _, a := range s.Addresses {
+			addrs = append(addrs, a.Addr)
+		}
+		sort.Strings(addrs)
+		c.addrs <- addrs
+	}
+	return nil
+}
+
+func (c *clientConn) ReportError(error) {
+	if c.addrs != nil {
+		c.addrs <- nil
+	}
+}
+
+// expectAddrs waits until the resolver reports the addresses
+func (c *clientConn) expectAddrs(t *testing.T, want ...string) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	var got []string
+	for {
+		select {
+		case got = <-c.addrs:
+			if reflect.DeepEqual(got, want) || (len(got) == 0 && len(want) == 0) {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("addresses = %v, want %v", got, want)
+		}
+	}
+}
+
+func register(t *testing.T, server *consultest.Server, id string, port int) *consul.Client {
+	t.Helper()
+	client, err := consul.New(append(server.Options(), discovery.WithName("svc"), discovery.WithId(id),
+		discovery.WithCheckAddr("127.0.0.1"), discovery.WithCheckPort(port))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+	if err = client.Register(); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestResolveAddresses(t *testing.T) {
+	server := consultest.NewServer()
+	t.Cleanup(server.Close)
+	a := register(t, server, "a", 8080)
+	b := register(t, server, "b", 8081)
+
+	u, err := url.Parse(fmt.Sprintf("consul://%s:%d/svc", server.Host(), server.Port()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc := &clientConn{addrs: make(chan []string, 100)}
+	r, err := NewBuilder().Build(grpcResolver.Target{URL: *u}, cc, grpcResolver.BuildOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(r.Close)
+	cc.expectAddrs(t, "127.0.0.1:8080", "127.0.0.1:8081")
+
+	if err = b.Deregister(); err != nil {
+		t.Fatal(err)
+	}
+	cc.expectAddrs(t, "127.0.0.1:8080")
+
+	c := register(t, server, "c", 8082)
+	cc.expectAddrs(t, "127.0.0.1:8080", "127.0.0.1:8082")
+
+	for _, client := range []*consul.Client{a, c} {
+		if err = client.Deregister(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cc.expectAddrs(t)
+}
+
+func TestBuildSharesClient(t *testing.T) {
+	server := consultest.NewServer()
+	defer server.Close()
+	b := NewBuilder().(*builder)
+	build := func(service string) grpcResolver.Resolver {
+		u, err := url.Parse(fmt.Sprintf("consul://%s:%d/%s", server.Host(), server.Port(), service))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := b.Build(grpcResolver.Target{URL: *u}, &clientConn{}, grpcResolver.BuildOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	first, second := build("a"), build("b")
+	if len(b.clients) != 1 {
+		t.Fatalf("clients = %d, want 1", len(b.clients))
+	}
+	first.Close()
+	first.Close()
+	if len(b.clients) != 1 {
+		t.Fatal("client closed while a resolver uses it")
+	}
+	second.Close()
+	if len(b.clients) != 0 {
+		t.Fatalf("clients = %d after closing the resolvers, want 0", len(b.clients))
+	}
+}
@@ -0,0 +1,192 @@
+package watcher
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/donetkit/contrib_discovery/discovery"
+)
+
+// ErrStopped is returned by Next once the watcher is stopped
+var ErrStopped = errors.New("watcher stopped")
+
+// Queue is an unbounded event queue backing the Next and Events methods of push based watchers
+type Queue struct {
+	exit      chan struct{}
+	closeOnce sync.Once
+
+	mu     sync.Mutex
+	queue  []*Event
+	signal chan struct{}
+
+	events     chan Event
+	eventsOnce sync.Once
+}
+
+// NewQueue returns an empty queue
+func NewQueue() *Queue {
+	return &Queue{
+		exit:   make(chan struct{}),
+		signal: make(chan struct{}, 1),
+	}
+}
+
+// Push appends the events, they are dropped once the queue is closed
+func (q *Queue) Push(events ...*Event) {
+	if len(events) == 0 {
+		return
+	}
+	q.mu.Lock()
+	select {
+	case <-q.exit:
+		q.mu.Unlock()
+		return
+	default:
+	}
+	q.queue = append(q.queue, events...)
+	q.mu.Unlock()
+
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+}
+
+// Pop blocks until an event is queued or the queue is closed
+func (q *Queue) Pop() (*Event, error) {
+	for {
+		q.mu.Lock()
+		if len(q.queue) > 0 {
+			e := q.queue[0]
+			q.queue = q.queue[1:]
+			q.mu.Unlock()
+			return e, nil
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-q.exit:
+			return nil, ErrStopped
+		case <-q.signal:
+		}
+	}
+}
+
+// Next pops the next event as a Result
+func (q *Queue) Next() (*Result, error) {
+	e, err := q.Pop()
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Action: e.Type.String(), Service: e.Service}, nil
+}
+
+// Events returns the queued events as a channel, it shares the queue with Next.
+// The channel is closed when the queue is closed.
+func (q *Queue) Events() <-chan Event {
+	q.eventsOnce.Do(func() {
+		q.events = make(chan Event)
+		go func() {
+			defer close(q.events)
+			for {
+				e, err := q.Pop()
+				if err != nil {
+					return
+				}
+				select {
+				case <-q.exit:
+					return
+				case q.events <- *e:
+				}
+			}
+		}()
+	})
+	return q.events
+}
+
+// Close drops the queued events and wakes the readers
+func (q *Queue) Close() {
+	q.closeOnce.Do(func() {
+		close(q.exit)
+		q.mu.Lock()
+		q.queue = nil
+		q.mu.Unlock()
+	})
+}
+
+// Done returns a channel closed when the queue is closed
+func (q *Queue) Done() <-chan struct{} {
+	return q.exit
+}
+
+// Diff returns the events of the nodes of a service changing from before to after, with the same
+// create/update/delete sequence as the consul watcher: a name-only create for a new service, then per version
+// a create, or a delete of the removed nodes followed by an update, a delete of the vanished versions and
+// a name-only delete once the service has no node left
+func Diff(idx uint64, name string, before, after []discovery.ServiceInstance) []*Event {
+	if len(before) == 0 && len(after) == 0 {
+		return nil
+	}
+
+	var events []*Event
+	if len(before) == 0 {
+		events = append(events, newEvent(idx, Create, &discovery.Service{Name: name}))
+	}
+
+	oldServices := discovery.GroupByVersion(name, before)
+	newServices := discovery.GroupByVersion(name, after)
+	oldNodes := make(map[string][]discovery.ServiceInstance, len(oldServices))
+	for _, svc := range oldServices {
+		oldNodes[svc.Version] = svc.Nodes
+	}
+	newNodes := make(map[string][]discovery.ServiceInstance, len(newServices))
+	for _, svc := range newServices {
+		newNodes[svc.Version] = svc.Nodes
+	}
+
+	for _, svc := range newServices {
+		old, ok := oldNodes[svc.Version]
+		if !ok {
+			events = append(events, newEvent(idx, Create, svc))
+			continue
+		}
+
+		var removed []discovery.ServiceInstance
+		for _, oldNode := range old {
+			var seen bool
+			for _, newNode := range svc.Nodes {
+				if newNode.GetId() == oldNode.GetId() {
+					seen = true
+					break
+				}
+			}
+			if !seen {
+				removed = append(removed, oldNode)
+			}
+		}
+		if len(removed) > 0 {
+			events = append(events, newEvent(idx, Delete, &discovery.Service{Name: name, Version: svc.Version, Nodes: removed}))
+		}
+		events = append(events, newEvent(idx, Update, svc))
+	}
+	for _, svc := range oldServices {
+		if _, ok := newNodes[svc.Version]; !ok {
+			events = append(events, newEvent(idx, Delete, svc))
+		}
+	}
+	if len(after) == 0 {
+		events = append(events, newEvent(idx, Delete, &discovery.Service{Name: name}))
+	}
+	return events
+}
+
+func newEvent(idx uint64, t EventType, service *discovery.Service) *Event {
+	return &Event{
+		Id:        strconv.FormatUint(idx, 10),
+		Type:      t,
+		Timestamp: time.Now(),
+		Service:   service,
+	}
+}
@@ -12,6 +12,13 @@ type Watcher interface {
 	Stop()
 }
 
+// EventWatcher is a Watcher that also emits typed events
+type EventWatcher interface {
+	Watcher
+	// Events returns the event stream, it shares the stream with Next
+	Events() <-chan Event
+}
+
 type WatchOption func(*WatchOptions)
 
 type Result struct {
@@ -26,6 +33,54 @@ type WatchOptions struct {
 	// Other options for implementations of the interface
 	// can be stored in a context
 	Context context.Context
+	// Tags the instances must all have
+	Tags []string
+	// Metadata key/values the instances must all have
+	Metadata map[string]string
+	// Datacenter to watch, blank for the agent's datacenter
+	Datacenter string
+	// PassingOnly drops the instances with a warning check, critical instances are always dropped
+	PassingOnly bool
+	// Filter is a Consul filter expression applied to the health query
+	Filter string
+}
+
+// Match reports whether the instance has the required tags, metadata and datacenter
+func (o WatchOptions) Match(ins discovery.ServiceInstance) bool {
+	if o.Datacenter != "" && ins.GetClusterName() != "" && ins.GetClusterName() != o.Datacenter {
+		return false
+	}
+	for _, required := range o.Tags {
+		var found bool
+		for _, tag := range ins.GetTags() {
+			if tag == required {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	metadata := ins.GetMetadata()
+	for k, v := range o.Metadata {
+		if value, ok := metadata[k]; !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Select returns the healthy instances matching the options
+func (o WatchOptions) Select(nodes []discovery.ServiceInstance) []discovery.ServiceInstance {
+	var matched []discovery.ServiceInstance
+	for _, node := range nodes {
+		if !node.IsHealthy() || !o.Match(node) {
+			continue
+		}
+		matched = append(matched, node)
+	}
+	return matched
 }
 
 // EventType defines registry event type
@@ -65,3 +120,57 @@ type Event struct {
 	// Service is registry service
 	Service *discovery.Service
 }
+
+// WatchService set service function
+func WatchService(name string) WatchOption {
+	return func(o *WatchOptions) {
+		o.Service = name
+	}
+}
+
+// WatchContext set context function, the watcher is stopped when ctx is done
+func WatchContext(ctx context.Context) WatchOption {
+	return func(o *WatchOptions) {
+		o.Context = ctx
+	}
+}
+
+// WatchTags set required tags function
+func WatchTags(tags ...string) WatchOption {
+	return func(o *WatchOptions) {
+		o.Tags = append(o.Tags, tags...)
+	}
+}
+
+// WatchMetadata set required metadata function
+func WatchMetadata(metadata map[string]string) WatchOption {
+	return func(o *WatchOptions) {
+		if o.Metadata == nil {
+			o.Metadata = make(map[string]string, len(metadata))
+		}
+		for k, v := range metadata {
+			o.Metadata[k] = v
+		}
+	}
+}
+
+// WatchDatacenter set datacenter function
+func WatchDatacenter(datacenter string) WatchOption {
+	return func(o *WatchOptions) {
+		o.Datacenter = datacenter
+	}
+}
+
+// WatchPassingOnly set passing only function, instances with a warning check are dropped
+func WatchPassingOnly() WatchOption {
+	return func(o *WatchOptions) {
+		o.PassingOnly = true
+	}
+}
+
+// WatchFilter set Consul filter expression function
+func WatchFilter(filter string) WatchOption {
+	return func(o *WatchOptions) {
+		o.Filter = filter
+	}
+}